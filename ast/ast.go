@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
 	"monkey/token"
 	"strings"
 )
@@ -12,6 +13,8 @@ type Node interface {
 	TokenLiteral() string
 	// 调试的时候打印 AST信息
 	String() string
+	// 节点在源码中的位置，用于报错
+	Pos() token.Position
 }
 
 // 语句
@@ -39,6 +42,12 @@ func (p *Program) TokenLiteral() string {
 		return ""
 	}
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -58,11 +67,14 @@ func (l *LetStatement) statementNode() {}
 func (l *LetStatement) TokenLiteral() string {
 	return l.Token.Literal
 }
+func (l *LetStatement) Pos() token.Position {
+	return l.Token.Pos
+}
 func (l *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(l.TokenLiteral() + " ")
 	out.WriteString(l.Name.String())
-	out.WriteString("=")
+	out.WriteString(" = ")
 	if l.Value != nil {
 		out.WriteString(l.Value.String())
 	}
@@ -80,6 +92,9 @@ func (r *ReturnStatement) statementNode() {}
 func (r *ReturnStatement) TokenLiteral() string {
 	return r.Token.Literal
 }
+func (r *ReturnStatement) Pos() token.Position {
+	return r.Token.Pos
+}
 func (r *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(r.TokenLiteral() + " ")
@@ -90,6 +105,86 @@ func (r *ReturnStatement) String() string {
 	return out.String()
 }
 
+// while 循环：while (x < 10) { ... }
+type WhileStatement struct {
+	Token     token.Token // token.WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+func (ws *WhileStatement) Pos() token.Position {
+	return ws.Token.Pos
+}
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+	return out.String()
+}
+
+// for 循环：for (x in iterable) { ... }，遍历数组的元素、hash 的键或者字符串的字符
+type ForStatement struct {
+	Token    token.Token // token.FOR
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForStatement) Pos() token.Position {
+	return fs.Token.Pos
+}
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for(")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+// break 和 continue 只能出现在循环中
+type BreakStatement struct {
+	Token token.Token // token.BREAK
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+func (bs *BreakStatement) String() string {
+	return bs.Token.Literal + ";"
+}
+
+type ContinueStatement struct {
+	Token token.Token // token.CONTINUE
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) Pos() token.Position {
+	return cs.Token.Pos
+}
+func (cs *ContinueStatement) String() string {
+	return cs.Token.Literal + ";"
+}
+
 // 除去let、return 就是表达式语句，例如：x+10；这种，在一些脚本语言中比较常见了
 type ExpressionStatement struct {
 	Token      token.Token
@@ -101,6 +196,9 @@ func (e *ExpressionStatement) statementNode() {}
 func (e *ExpressionStatement) TokenLiteral() string {
 	return e.Token.Literal
 }
+func (e *ExpressionStatement) Pos() token.Position {
+	return e.Token.Pos
+}
 func (e *ExpressionStatement) String() string {
 	//var out bytes.Buffer
 	if e.Expression != nil {
@@ -119,6 +217,9 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -131,8 +232,20 @@ type IntegerLiteral struct {
 // 实现接口
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+// 浮点数字面量
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -144,6 +257,9 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -165,6 +281,9 @@ func (ie *InfixExpression) expressionNode() {}
 func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *InfixExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -175,6 +294,32 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// 赋值表达式：x = 5、x += 1、arr[0] = 1
+// Target 只能是 Identifier 或者 IndexExpression
+type AssignExpression struct {
+	Token    token.Token // =、+= 等
+	Operator string
+	Target   Expression
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) Pos() token.Position {
+	return ae.Token.Pos
+}
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+	return out.String()
+}
+
 // bool 字面量
 type Boolean struct {
 	Token token.Token
@@ -185,6 +330,9 @@ func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
+func (b *Boolean) Pos() token.Position {
+	return b.Token.Pos
+}
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -201,6 +349,9 @@ func (i *IfExpression) expressionNode() {}
 func (i *IfExpression) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *IfExpression) Pos() token.Position {
+	return i.Token.Pos
+}
 func (i *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -214,6 +365,40 @@ func (i *IfExpression) String() string {
 	return out.String()
 }
 
+// try { } catch (e) { } finally { }，catch 和 finally 至少有一个，catch 的参数可以省略
+type TryExpression struct {
+	Token          token.Token // try
+	Block          *BlockStatement
+	CatchParameter *Identifier
+	Catch          *BlockStatement
+	Finally        *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.CatchParameter != nil {
+			out.WriteString("(" + te.CatchParameter.String() + ") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token // "{"
 	Statements []Statement
@@ -223,6 +408,9 @@ func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -235,12 +423,16 @@ type FunctionLiteral struct {
 	Token      token.Token // "fn"
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Name       string // let 绑定的名字，匿名函数为空
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
@@ -248,6 +440,9 @@ func (fl *FunctionLiteral) String() string {
 		params = append(params, p.String())
 	}
 	out.WriteString(fl.TokenLiteral())
+	if fl.Name != "" {
+		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
@@ -265,6 +460,9 @@ func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *CallExpression) Pos() token.Position {
+	return ce.Token.Pos
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -288,6 +486,9 @@ func (sl *StringLiteral) expressionNode() {}
 func (sl *StringLiteral) TokenLiteral() string {
 	return sl.Token.Literal
 }
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
 func (sl *StringLiteral) String() string {
 	return sl.Token.Literal
 }
@@ -302,6 +503,9 @@ func (al *ArrayLiteral) expressionNode() {}
 func (al *ArrayLiteral) TokenLiteral() string {
 	return al.Token.Literal
 }
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -324,6 +528,9 @@ func (ie *IndexExpression) expressionNode() {}
 func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IndexExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer 
 	out.WriteString("(") 
@@ -338,20 +545,53 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys []Expression // Pairs 中的 key，按照在源码中出现的顺序
 }
 //
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
+func (hl *HashLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer 
 	pairs := []string{} 
-	for key, value := range hl.Pairs { 
-		pairs = append(pairs, key.String()+":"+value.String()) 
-	} 
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
+	}
 	out.WriteString("{") 
 	out.WriteString(strings.Join(pairs, ", ")) 
 	out.WriteString("}") 
 	return out.String()
+}
+
+
+// macro 字面量，和函数字面量结构相同
+type MacroLiteral struct {
+	Token      token.Token // "macro"
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+func (ml *MacroLiteral) TokenLiteral() string {
+	return ml.Token.Literal
+}
+func (ml *MacroLiteral) Pos() token.Position {
+	return ml.Token.Pos
+}
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(ml.Body.String())
+	return out.String()
 }
\ No newline at end of file
@@ -0,0 +1,182 @@
+package ast
+
+// 深度复制 AST，Modify 会原地修改节点，需要保留原来的 AST 时先复制一份
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		n := *node
+		n.Statements = copyStatements(node.Statements)
+		return &n
+	case *LetStatement:
+		n := *node
+		n.Name = copyIdentifier(node.Name)
+		n.Value = copyExpression(node.Value)
+		return &n
+	case *ReturnStatement:
+		n := *node
+		n.ReturnValue = copyExpression(node.ReturnValue)
+		return &n
+	case *WhileStatement:
+		n := *node
+		n.Condition = copyExpression(node.Condition)
+		n.Body = copyBlock(node.Body)
+		return &n
+	case *ForStatement:
+		n := *node
+		n.Variable = copyIdentifier(node.Variable)
+		n.Iterable = copyExpression(node.Iterable)
+		n.Body = copyBlock(node.Body)
+		return &n
+	case *BreakStatement:
+		n := *node
+		return &n
+	case *ContinueStatement:
+		n := *node
+		return &n
+	case *ExpressionStatement:
+		n := *node
+		n.Expression = copyExpression(node.Expression)
+		return &n
+	case *BlockStatement:
+		n := *node
+		n.Statements = copyStatements(node.Statements)
+		return &n
+	case *Identifier:
+		n := *node
+		return &n
+	case *IntegerLiteral:
+		n := *node
+		return &n
+	case *FloatLiteral:
+		n := *node
+		return &n
+	case *Boolean:
+		n := *node
+		return &n
+	case *StringLiteral:
+		n := *node
+		return &n
+	case *PrefixExpression:
+		n := *node
+		n.Right = copyExpression(node.Right)
+		return &n
+	case *InfixExpression:
+		n := *node
+		n.Left = copyExpression(node.Left)
+		n.Right = copyExpression(node.Right)
+		return &n
+	case *AssignExpression:
+		n := *node
+		n.Target = copyExpression(node.Target)
+		n.Value = copyExpression(node.Value)
+		return &n
+	case *IfExpression:
+		n := *node
+		n.Condition = copyExpression(node.Condition)
+		n.Consequence = copyBlock(node.Consequence)
+		n.Alternative = copyBlock(node.Alternative)
+		return &n
+	case *TryExpression:
+		n := *node
+		n.Block = copyBlock(node.Block)
+		n.CatchParameter = copyIdentifier(node.CatchParameter)
+		n.Catch = copyBlock(node.Catch)
+		n.Finally = copyBlock(node.Finally)
+		return &n
+	case *FunctionLiteral:
+		n := *node
+		n.Parameters = copyIdentifiers(node.Parameters)
+		n.Body = copyBlock(node.Body)
+		return &n
+	case *MacroLiteral:
+		n := *node
+		n.Parameters = copyIdentifiers(node.Parameters)
+		n.Body = copyBlock(node.Body)
+		return &n
+	case *CallExpression:
+		n := *node
+		n.Function = copyExpression(node.Function)
+		n.Arguments = copyExpressions(node.Arguments)
+		return &n
+	case *ArrayLiteral:
+		n := *node
+		n.Elements = copyExpressions(node.Elements)
+		return &n
+	case *IndexExpression:
+		n := *node
+		n.Left = copyExpression(node.Left)
+		n.Index = copyExpression(node.Index)
+		return &n
+	case *HashLiteral:
+		// Keys 中的 key 和 Pairs 中的是同一个节点，复制后也要保持一致
+		n := *node
+		n.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		n.Keys = nil
+		copied := make(map[Expression]Expression, len(node.Pairs))
+		for key, val := range node.Pairs {
+			newKey := copyExpression(key)
+			n.Pairs[newKey] = copyExpression(val)
+			copied[key] = newKey
+		}
+		for _, key := range node.Keys {
+			n.Keys = append(n.Keys, copied[key])
+		}
+		return &n
+	}
+	return node
+}
+
+func copyExpression(exp Expression) Expression {
+	if exp == nil {
+		return nil
+	}
+	copied, _ := Copy(exp).(Expression)
+	return copied
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return Copy(block).(*BlockStatement)
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	return Copy(ident).(*Identifier)
+}
+
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+	copied := make([]Statement, len(statements))
+	for i, s := range statements {
+		copied[i], _ = Copy(s).(Statement)
+	}
+	return copied
+}
+
+func copyExpressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+	copied := make([]Expression, len(expressions))
+	for i, e := range expressions {
+		copied[i] = copyExpression(e)
+	}
+	return copied
+}
+
+func copyIdentifiers(idents []*Identifier) []*Identifier {
+	if idents == nil {
+		return nil
+	}
+	copied := make([]*Identifier, len(idents))
+	for i, ident := range idents {
+		copied[i] = copyIdentifier(ident)
+	}
+	return copied
+}
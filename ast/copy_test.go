@@ -0,0 +1,92 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	key := one()
+
+	// let f = fn(x) { if (1) { [1] } else { {1: 1}[1] } }; f(1)
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "f"},
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{{Value: "x"}},
+					Body: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &IfExpression{
+							Condition: one(),
+							Consequence: &BlockStatement{Statements: []Statement{
+								&ExpressionStatement{Expression: &ArrayLiteral{Elements: []Expression{one()}}},
+							}},
+							Alternative: &BlockStatement{Statements: []Statement{
+								&ExpressionStatement{Expression: &IndexExpression{
+									Left: &HashLiteral{
+										Pairs: map[Expression]Expression{key: one()},
+										Keys:  []Expression{key},
+									},
+									Index: one(),
+								}},
+							}},
+						}},
+					}},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function:  &Identifier{Value: "f"},
+				Arguments: []Expression{one()},
+			}},
+		},
+	}
+	copied := Copy(program)
+	if copied == Node(program) {
+		t.Fatalf("Copy returned the original node")
+	}
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	}
+	Modify(copied, turnOneIntoTwo)
+
+	integers := func(node Node) []int64 {
+		var values []int64
+		Inspect(node, func(node Node) bool {
+			if integer, ok := node.(*IntegerLiteral); ok {
+				values = append(values, integer.Value)
+			}
+			return true
+		})
+		return values
+	}
+	if got := integers(program); !reflect.DeepEqual(got, []int64{1, 1, 1, 1, 1, 1}) {
+		t.Errorf("original modified. got=%v", got)
+	}
+	if got := integers(copied); !reflect.DeepEqual(got, []int64{2, 2, 2, 2, 2, 2}) {
+		t.Errorf("copy not modified. got=%v", got)
+	}
+
+	var hash *HashLiteral
+	Inspect(copied, func(node Node) bool {
+		if h, ok := node.(*HashLiteral); ok {
+			hash = h
+		}
+		return true
+	})
+	if hash == nil || len(hash.Keys) != 1 {
+		t.Fatalf("hash literal not copied. got=%#v", hash)
+	}
+	if _, ok := hash.Pairs[hash.Keys[0]]; !ok {
+		t.Errorf("Keys and Pairs of the copied hash differ")
+	}
+	if hash.Keys[0] == key {
+		t.Errorf("hash key not copied")
+	}
+}
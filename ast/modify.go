@@ -5,6 +5,7 @@ package ast
 type ModifierFunc func(Node) Node
 
 
+// 深度优先遍历 AST，先修改子节点，再对节点本身调用 modifier
 func Modify(node Node, modifier ModifierFunc) Node { 
 	switch node := node.(type) { 
 	case *Program: 
@@ -13,6 +14,80 @@ func Modify(node Node, modifier ModifierFunc) Node {
 		} 
 	case *ExpressionStatement: 
 		node.Expression, _ = Modify(node.Expression, modifier).(Expression) 
+	case *InfixExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *AssignExpression:
+		node.Target, _ = Modify(node.Target, modifier).(Expression)
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *PrefixExpression:
+		node.Right, _ = Modify(node.Right, modifier).(Expression)
+	case *IndexExpression:
+		node.Left, _ = Modify(node.Left, modifier).(Expression)
+		node.Index, _ = Modify(node.Index, modifier).(Expression)
+	case *IfExpression:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+	case *TryExpression:
+		node.Block, _ = Modify(node.Block, modifier).(*BlockStatement)
+		if node.CatchParameter != nil {
+			node.CatchParameter, _ = Modify(node.CatchParameter, modifier).(*Identifier)
+		}
+		if node.Catch != nil {
+			node.Catch, _ = Modify(node.Catch, modifier).(*BlockStatement)
+		}
+		if node.Finally != nil {
+			node.Finally, _ = Modify(node.Finally, modifier).(*BlockStatement)
+		}
+	case *BlockStatement:
+		for i := range node.Statements {
+			node.Statements[i], _ = Modify(node.Statements[i], modifier).(Statement)
+		}
+	case *WhileStatement:
+		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *ForStatement:
+		node.Variable, _ = Modify(node.Variable, modifier).(*Identifier)
+		node.Iterable, _ = Modify(node.Iterable, modifier).(Expression)
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *ReturnStatement:
+		node.ReturnValue, _ = Modify(node.ReturnValue, modifier).(Expression)
+	case *LetStatement:
+		node.Value, _ = Modify(node.Value, modifier).(Expression)
+	case *FunctionLiteral:
+		for i := range node.Parameters {
+			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *MacroLiteral:
+		for i := range node.Parameters {
+			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
+		}
+		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
+	case *CallExpression:
+		node.Function, _ = Modify(node.Function, modifier).(Expression)
+		for i := range node.Arguments {
+			node.Arguments[i], _ = Modify(node.Arguments[i], modifier).(Expression)
+		}
+	case *ArrayLiteral:
+		for i := range node.Elements {
+			node.Elements[i], _ = Modify(node.Elements[i], modifier).(Expression)
+		}
+	case *HashLiteral:
+		// 和 Walk 一样按 key 在源码中的顺序修改，key 也可能被修改，所以 Pairs 和 Keys 一起重新构建
+		newPairs := make(map[Expression]Expression, len(node.Keys))
+		newKeys := make([]Expression, 0, len(node.Keys))
+		for _, key := range node.Keys {
+			newKey, _ := Modify(key, modifier).(Expression)
+			newVal, _ := Modify(node.Pairs[key], modifier).(Expression)
+			newPairs[newKey] = newVal
+			newKeys = append(newKeys, newKey)
+		}
+		node.Pairs = newPairs
+		node.Keys = newKeys
 	} 
 	return modifier(node) 
-}
\ No newline at end of file
+}
@@ -40,6 +40,106 @@ func TestModify(t *testing.T) {
 				}, 
 			}, 
 		}, 
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&AssignExpression{Operator: "=", Target: &IndexExpression{Left: one(), Index: one()}, Value: one()},
+			&AssignExpression{Operator: "=", Target: &IndexExpression{Left: two(), Index: two()}, Value: two()},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+				Alternative: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Consequence: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Value: one()},
+			&LetStatement{Value: two()},
+		},
+		{
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&FunctionLiteral{
+				Parameters: []*Identifier{},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
+		{
+			&CallExpression{Function: one(), Arguments: []Expression{one(), two()}},
+			&CallExpression{Function: two(), Arguments: []Expression{two(), two()}},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
 	}
 	for _, tt := range tests { 
 		modified := Modify(tt.input, turnOneIntoTwo)
@@ -48,4 +148,98 @@ func TestModify(t *testing.T) {
 			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected) 
 		} 
 	} 
-}
\ No newline at end of file
+
+	key1, key2 := one(), one()
+	hashLiteral := &HashLiteral{
+		Pairs: map[Expression]Expression{
+			key1: one(),
+			key2: one(),
+		},
+		Keys: []Expression{key1, key2},
+	}
+	Modify(hashLiteral, turnOneIntoTwo)
+	if len(hashLiteral.Pairs) != 2 || len(hashLiteral.Keys) != 2 {
+		t.Fatalf("wrong number of pairs. got=%d pairs, %d keys", len(hashLiteral.Pairs), len(hashLiteral.Keys))
+	}
+	for _, key := range hashLiteral.Keys {
+		value, ok := hashLiteral.Pairs[key]
+		if !ok {
+			t.Fatalf("key %v is not in Pairs", key)
+		}
+		key, _ := key.(*IntegerLiteral)
+		if key.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, key.Value)
+		}
+		val, _ := value.(*IntegerLiteral)
+		if val.Value != 2 {
+			t.Errorf("value is not %d, got=%d", 2, val.Value)
+		}
+	}
+}
+
+// hash 字面量按 key 在源码中的顺序修改，每个 key 之后是它的值，最后是 hash 本身
+func TestModifyHashLiteralOrder(t *testing.T) {
+	integer := func(v int64) *IntegerLiteral { return &IntegerLiteral{Value: v} }
+
+	hashLiteral := &HashLiteral{Pairs: map[Expression]Expression{}}
+	for i := int64(1); i <= 10; i += 2 {
+		key := integer(i)
+		hashLiteral.Pairs[key] = integer(i + 1)
+		hashLiteral.Keys = append(hashLiteral.Keys, key)
+	}
+
+	var order []int64
+	Modify(hashLiteral, func(node Node) Node {
+		switch node := node.(type) {
+		case *IntegerLiteral:
+			order = append(order, node.Value)
+			return integer(node.Value * 10)
+		case *HashLiteral:
+			order = append(order, 0)
+		}
+		return node
+	})
+
+	expected := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 0}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("wrong modifier call order. want=%v, got=%v", expected, order)
+	}
+
+	for i, key := range hashLiteral.Keys {
+		want := int64(2*i+1) * 10
+		if key.(*IntegerLiteral).Value != want {
+			t.Errorf("Keys[%d] is not %d. got=%s", i, want, key)
+		}
+		val, ok := hashLiteral.Pairs[key]
+		if !ok {
+			t.Fatalf("Keys[%d] is not in Pairs", i)
+		}
+		if val.(*IntegerLiteral).Value != want+10 {
+			t.Errorf("value of %s is not %d. got=%s", key, want+10, val)
+		}
+	}
+}
+
+func TestModifyCatchParameter(t *testing.T) {
+	try := &TryExpression{
+		Block:          &BlockStatement{},
+		CatchParameter: &Identifier{Value: "e"},
+		Catch:          &BlockStatement{},
+	}
+
+	var visited []string
+	Modify(try, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok {
+			visited = append(visited, ident.Value)
+			return &Identifier{Value: "err"}
+		}
+		return node
+	})
+
+	if len(visited) != 1 || visited[0] != "e" {
+		t.Errorf("modifier not called on the catch parameter. got=%v", visited)
+	}
+	if try.CatchParameter.Value != "err" {
+		t.Errorf("catch parameter not replaced. got=%s", try.CatchParameter.Value)
+	}
+}
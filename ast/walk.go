@@ -0,0 +1,119 @@
+package ast
+
+// 只读的遍历方式，和 go/ast 中的 Walk、Inspect 用法一致
+
+// 对遍历到的每个节点调用 Visit，返回值 w 不为 nil 时，
+// 继续用 w 遍历该节点的子节点，最后再调用一次 w.Visit(nil)
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// 深度优先遍历 AST
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+	case *LetStatement:
+		Walk(v, n.Name)
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			Walk(v, n.ReturnValue)
+		}
+	case *WhileStatement:
+		Walk(v, n.Condition)
+		Walk(v, n.Body)
+	case *ForStatement:
+		Walk(v, n.Variable)
+		Walk(v, n.Iterable)
+		Walk(v, n.Body)
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			Walk(v, n.Expression)
+		}
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(v, s)
+		}
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Right)
+	case *AssignExpression:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+	case *IfExpression:
+		Walk(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *TryExpression:
+		Walk(v, n.Block)
+		if n.CatchParameter != nil {
+			Walk(v, n.CatchParameter)
+		}
+		if n.Catch != nil {
+			Walk(v, n.Catch)
+		}
+		if n.Finally != nil {
+			Walk(v, n.Finally)
+		}
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		Walk(v, n.Body)
+	case *MacroLiteral:
+		for _, p := range n.Parameters {
+			Walk(v, p)
+		}
+		Walk(v, n.Body)
+	case *CallExpression:
+		Walk(v, n.Function)
+		for _, a := range n.Arguments {
+			Walk(v, a)
+		}
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			Walk(v, e)
+		}
+	case *IndexExpression:
+		Walk(v, n.Left)
+		Walk(v, n.Index)
+	case *HashLiteral:
+		for _, key := range n.Keys {
+			Walk(v, key)
+			Walk(v, n.Pairs[key])
+		}
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *Boolean, *StringLiteral,
+		*BreakStatement, *ContinueStatement:
+		// 叶子节点
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// 深度优先遍历 AST，对每个节点调用 f(node)，f 返回 false 时不再进入该节点的子节点
+// 每个节点的子节点遍历完之后会调用一次 f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,109 @@
+package ast
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	integer := func(v int64) *IntegerLiteral { return &IntegerLiteral{Value: v} }
+
+	// let f = fn(x) { if (x) { x + 1 } else { -x } }; f([2][0]);
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("x")},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: &IfExpression{
+								Condition: ident("x"),
+								Consequence: &BlockStatement{Statements: []Statement{
+									&ExpressionStatement{Expression: &InfixExpression{
+										Left: ident("x"), Operator: "+", Right: integer(1),
+									}},
+								}},
+								Alternative: &BlockStatement{Statements: []Statement{
+									&ExpressionStatement{Expression: &PrefixExpression{
+										Operator: "-", Right: ident("x"),
+									}},
+								}},
+							}},
+						},
+					},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: ident("f"),
+				Arguments: []Expression{
+					&IndexExpression{
+						Left:  &ArrayLiteral{Elements: []Expression{integer(2)}},
+						Index: integer(0),
+					},
+				},
+			}},
+		},
+	}
+
+	var idents []string
+	var integers []int64
+	nils := 0
+	Inspect(program, func(node Node) bool {
+		switch n := node.(type) {
+		case nil:
+			nils++
+		case *Identifier:
+			idents = append(idents, n.Value)
+		case *IntegerLiteral:
+			integers = append(integers, n.Value)
+		}
+		return true
+	})
+
+	expectedIdents := []string{"f", "x", "x", "x", "x", "f"}
+	if len(idents) != len(expectedIdents) {
+		t.Fatalf("wrong identifiers. want=%v, got=%v", expectedIdents, idents)
+	}
+	for i, name := range expectedIdents {
+		if idents[i] != name {
+			t.Errorf("idents[%d] wrong. want=%q, got=%q", i, name, idents[i])
+		}
+	}
+	expectedIntegers := []int64{1, 2, 0}
+	if len(integers) != len(expectedIntegers) {
+		t.Fatalf("wrong integers. want=%v, got=%v", expectedIntegers, integers)
+	}
+	for i, v := range expectedIntegers {
+		if integers[i] != v {
+			t.Errorf("integers[%d] wrong. want=%d, got=%d", i, v, integers[i])
+		}
+	}
+	// 每个被访问的节点都对应一次 Visit(nil)
+	visited := 0
+	Inspect(program, func(node Node) bool {
+		if node != nil {
+			visited++
+		}
+		return true
+	})
+	if nils != visited {
+		t.Errorf("Visit(nil) count mismatch. visited=%d, nils=%d", visited, nils)
+	}
+
+	// 返回 false 时不进入子节点
+	var skipped []string
+	Inspect(program, func(node Node) bool {
+		if id, ok := node.(*Identifier); ok {
+			skipped = append(skipped, id.Value)
+		}
+		_, isFn := node.(*FunctionLiteral)
+		return !isFn
+	})
+	if len(skipped) != 2 {
+		t.Errorf("function body should be skipped. got=%v", skipped)
+	}
+}
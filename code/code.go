@@ -0,0 +1,270 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// 字节码指令：一个字节的操作码，后面跟着若干个大端序的操作数
+type Instructions []byte
+
+// 反汇编，每行一条指令：偏移量 操作码 操作数
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n",
+			len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // 把常量池中的常量压栈
+
+	// 二元运算，弹出两个操作数，结果压栈
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+
+	OpPop // 弹出栈顶，表达式语句结束时使用
+
+	OpTrue
+	OpFalse
+
+	// 比较运算
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+	OpLessThan
+	OpLessThanOrEqual
+
+	// 前缀运算
+	OpMinus
+	OpBang
+
+	// 跳转，操作数是跳转目标的绝对偏移量
+	OpJumpNotTruthy
+	OpJump
+
+	OpNull
+
+	OpGetGlobal
+	OpSetGlobal
+	OpAssignGlobal // 和 OpSetGlobal 相同，但变量还没有赋值时报错，用于赋值表达式
+
+	OpArray   // 操作数是元素个数
+	OpHash    // 操作数是键和值的总个数
+	OpHashKey // 检查栈顶的值能否作为 hash 的键，不能时在键的位置报错，值留在栈上
+	OpIndex
+	OpIndexKeep // 和 OpIndex 相同，但保留栈上的集合和下标，用于复合赋值
+	OpSetIndex  // 栈上依次是集合、下标和值，赋值后把值留在栈上
+
+	OpCall        // 操作数是参数个数
+	OpReturnValue // 返回栈顶的值
+	OpReturn      // 没有返回值，返回 null
+
+	OpGetLocal
+	OpSetLocal
+
+	OpGetBuiltin
+
+	OpIterInit // 把栈顶的数组、hash 或字符串换成迭代器
+	OpIterNext // 弹出迭代器，还有元素时压入下一个元素，否则跳转到操作数的位置
+
+	OpTry    // 进入 try 块，操作数是出错时跳转的位置，跳转后错误对象在栈顶
+	OpEndTry // 离开 try 块
+	OpCatch  // 把栈顶的错误对象换成 catch 得到的 hash
+	OpThrow  // 弹出错误对象，重新抛出
+
+	OpClosure        // 操作数是函数在常量池中的下标和自由变量个数
+	OpGetFree        // 读取闭包捕获的自由变量
+	OpCurrentClosure // 把当前执行的闭包压栈，用于递归调用自身
+
+	OpBox     // 把栈顶的值换成装着它的 cell，被闭包捕获并且会被赋值的变量保存在 cell 中
+	OpGetCell // 把栈顶的 cell 换成其中的值
+	OpSetCell // 栈上依次是值和 cell，把值存入 cell，两者都弹出
+
+	OpUndefined // 使用了未定义的变量，操作数是变量名在常量池中的下标，执行到时报错
+
+	OpQuote // 操作数是 quote 在常量池中的下标和 unquote 的个数，弹出 unquote 的值，替换后压入新的 quote
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int // 每个操作数占用的字节数
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+	OpMod: {"OpMod", []int{}},
+
+	OpPop: {"OpPop", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+
+	OpEqual:              {"OpEqual", []int{}},
+	OpNotEqual:           {"OpNotEqual", []int{}},
+	OpGreaterThan:        {"OpGreaterThan", []int{}},
+	OpGreaterThanOrEqual: {"OpGreaterThanOrEqual", []int{}},
+	OpLessThan:           {"OpLessThan", []int{}},
+	OpLessThanOrEqual:    {"OpLessThanOrEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpNull: {"OpNull", []int{}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+
+	OpArray:   {"OpArray", []int{2}},
+	OpHash:    {"OpHash", []int{2}},
+	OpHashKey: {"OpHashKey", []int{}},
+	OpIndex:   {"OpIndex", []int{}},
+
+	OpIndexKeep: {"OpIndexKeep", []int{}},
+	OpSetIndex:  {"OpSetIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpGetLocal: {"OpGetLocal", []int{1}},
+	OpSetLocal: {"OpSetLocal", []int{1}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpIterInit: {"OpIterInit", []int{}},
+	OpIterNext: {"OpIterNext", []int{2}},
+
+	OpTry:    {"OpTry", []int{2}},
+	OpEndTry: {"OpEndTry", []int{}},
+	OpCatch:  {"OpCatch", []int{}},
+	OpThrow:  {"OpThrow", []int{}},
+
+	OpClosure:        {"OpClosure", []int{2, 1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpBox:     {"OpBox", []int{}},
+	OpGetCell: {"OpGetCell", []int{}},
+	OpSetCell: {"OpSetCell", []int{}},
+
+	OpUndefined: {"OpUndefined", []int{2}},
+
+	OpQuote: {"OpQuote", []int{2, 2}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// 生成一条指令
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// 按照定义读取操作数，返回操作数和读取的字节数
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
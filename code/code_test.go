@@ -0,0 +1,132 @@
+package code
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+					i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	pos := func(line int) token.Position { return token.Position{Line: line, Column: 1} }
+
+	var m SourceMap
+	m = m.Add(0, pos(1))
+	m = m.Add(3, pos(1))
+	m = m.Add(4, pos(2))
+	m = m.Add(7, pos(3))
+	if len(m) != 3 {
+		t.Fatalf("wrong number of entries. want=3, got=%d", len(m))
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, pos(1)},
+		{3, pos(1)},
+		{4, pos(2)},
+		{6, pos(2)},
+		{7, pos(3)},
+		{100, pos(3)},
+	}
+	for _, tt := range tests {
+		if got := m.Lookup(tt.offset); got != tt.expected {
+			t.Errorf("wrong position at %d. want=%s, got=%s", tt.offset, tt.expected, got)
+		}
+	}
+
+	m = m.Truncate(4)
+	if got := m.Lookup(5); got != pos(1) {
+		t.Errorf("wrong position after truncate. want=%s, got=%s", pos(1), got)
+	}
+	if got := (SourceMap{}).Lookup(0); got.IsValid() {
+		t.Errorf("empty source map returned a valid position %s", got)
+	}
+}
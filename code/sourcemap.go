@@ -0,0 +1,38 @@
+package code
+
+import (
+	"monkey/token"
+	"sort"
+)
+
+// 指令和源码位置的对应关系，虚拟机报错时用来找到出错的位置
+// 按照偏移量递增，每一项对应从 Offset 开始、到下一项之前的指令
+type SourceMap []SourcePos
+
+type SourcePos struct {
+	Offset int
+	Pos    token.Position
+}
+
+// 记录从 offset 开始的指令的位置，和上一项相同时不需要新的一项
+func (m SourceMap) Add(offset int, pos token.Position) SourceMap {
+	if len(m) > 0 && m[len(m)-1].Pos == pos {
+		return m
+	}
+	return append(m, SourcePos{Offset: offset, Pos: pos})
+}
+
+// 去掉 offset 及之后的指令的位置，删除指令时使用
+func (m SourceMap) Truncate(offset int) SourceMap {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset >= offset })
+	return m[:i]
+}
+
+// 偏移量为 offset 的指令所在的位置，没有记录时返回无效的位置
+func (m SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return m[i-1].Pos
+}
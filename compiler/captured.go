@@ -0,0 +1,121 @@
+package compiler
+
+import "monkey/ast"
+
+// 函数中需要放在 cell 里的局部变量：在这个函数中定义（参数、let、for、catch），
+// 被内层的函数引用，并且会重新绑定（赋值、for 和 catch 的变量、多次或者在循环中 let），
+// 或者在定义之前就被内层函数引用。外层函数和闭包通过同一个 cell 读写变量，
+// 和求值器中共享同一个环境的效果一致。只按名字判断，遮蔽时可能多装箱，但不影响结果
+func capturedAssignments(fn *ast.FunctionLiteral) []string {
+	a := &captureAnalysis{
+		lets:          map[string]int{},
+		rebound:       map[string]bool{},
+		captured:      map[string]bool{},
+		capturedEarly: map[string]bool{},
+	}
+	for _, p := range fn.Parameters {
+		a.declare(p.Value)
+		a.lets[p.Value]++
+	}
+	a.walk(fn.Body, false, false)
+
+	names := []string{}
+	for _, name := range a.declared {
+		if a.captured[name] && (a.rebound[name] || a.lets[name] > 1 || a.capturedEarly[name]) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+type captureAnalysis struct {
+	declared      []string
+	lets          map[string]int  // let 定义的次数，循环中的 let 算作多次
+	rebound       map[string]bool // 被赋值，或者是 for、catch 的变量
+	captured      map[string]bool // 被内层函数引用
+	capturedEarly map[string]bool // 在这个函数定义它之前被内层函数引用
+}
+
+func (a *captureAnalysis) declare(name string) {
+	for _, declared := range a.declared {
+		if declared == name {
+			return
+		}
+	}
+	a.declared = append(a.declared, name)
+}
+
+func (a *captureAnalysis) isDeclared(name string) bool {
+	for _, declared := range a.declared {
+		if declared == name {
+			return true
+		}
+	}
+	return false
+}
+
+// inner 表示在内层函数中，inLoop 表示在这个函数的循环中
+func (a *captureAnalysis) walk(node ast.Node, inner bool, inLoop bool) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			if n != node {
+				a.walk(n, true, false)
+				return false
+			}
+		case *ast.WhileStatement:
+			if n != node {
+				a.walk(n, inner, true)
+				return false
+			}
+		case *ast.ForStatement:
+			if n != node {
+				a.walk(n, inner, true)
+				return false
+			}
+			if !inner {
+				a.declare(n.Variable.Value)
+				a.rebound[n.Variable.Value] = true
+			}
+		case *ast.TryExpression:
+			if !inner && n.CatchParameter != nil {
+				a.declare(n.CatchParameter.Value)
+				a.rebound[n.CatchParameter.Value] = true
+			}
+		case *ast.LetStatement:
+			if !inner {
+				a.declare(n.Name.Value)
+				a.lets[n.Name.Value]++
+				if inLoop {
+					a.lets[n.Name.Value]++
+				}
+			}
+		case *ast.AssignExpression:
+			if target, ok := n.Target.(*ast.Identifier); ok {
+				a.rebound[target.Value] = true
+			}
+		case *ast.Identifier:
+			if inner {
+				a.captured[n.Value] = true
+				if !a.isDeclared(n.Value) {
+					a.capturedEarly[n.Value] = true
+				}
+			}
+		}
+		return true
+	})
+}
+
+// 节点中是否有给 name 赋值的表达式，包括内层的函数
+func assignsTo(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignExpression); ok {
+			if target, ok := assign.Target.(*ast.Identifier); ok && target.Value == name {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,939 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+// 把 AST 编译为字节码，交给虚拟机执行
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// 每个函数体对应一个编译作用域
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap // 指令对应的源码位置
+
+	loops []*loopContext // 当前所在的循环，最内层的在最后
+	tries []*tryContext  // 当前所在的 try 块，最内层的在最后
+}
+
+// 记录 continue 跳转的目标，以及等待回填的 break 跳转
+type loopContext struct {
+	continuePos int
+	breakJumps  []int
+	tries       int // 进入循环时所在的 try 块个数
+}
+
+// break、continue 和 return 离开 try 块时，需要先撤销 OpTry 并执行 finally
+type tryContext struct {
+	handler bool // 是否有 OpTry 还没有撤销
+	finally *ast.BlockStatement
+}
+
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pos token.Position // 正在编译的节点的位置，生成的指令记下这个位置
+}
+
+func New() *Compiler {
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	symbolTable := NewSymbolTable()
+
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// 沿用之前的符号表和常量池，REPL 中每一行都是单独编译的
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// 编译的主函数
+// 生成的指令使用最内层节点的位置，编译完一个节点后恢复外层节点的位置
+func (c *Compiler) Compile(node ast.Node) error {
+	if pos := node.Pos(); pos.IsValid() {
+		defer func(outer token.Position) { c.pos = outer }(c.pos)
+		c.pos = pos
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		c.declareGlobals(node)
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ExpressionStatement:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		op, ok := infixOperators[node.Operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
+		}
+
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		// 跳转的目标还不知道，先用假的偏移量占位，之后再回填
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+		c.leaveBlockValue()
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.Compile(node.Alternative)
+			if err != nil {
+				return err
+			}
+			c.leaveBlockValue()
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.TryExpression:
+		return c.compileTryExpression(node)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.WhileStatement:
+		loop := c.enterLoop(len(c.currentInstructions()))
+
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+		exitJumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, loop.continuePos)
+
+		c.changeOperand(exitJumpPos, len(c.currentInstructions()))
+		c.leaveLoop()
+		c.emitLoopValue()
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.BreakStatement, *ast.ContinueStatement:
+		loops := c.scopes[c.scopeIndex].loops
+		if len(loops) == 0 {
+			return fmt.Errorf("%s: %s outside loop", node.Pos(), node.TokenLiteral())
+		}
+		loop := loops[len(loops)-1]
+		err := c.leaveTries(loop.tries)
+		if err != nil {
+			return err
+		}
+		if _, ok := node.(*ast.BreakStatement); ok {
+			loop.breakJumps = append(loop.breakJumps, c.emit(code.OpJump, 9999))
+		} else {
+			c.emit(code.OpJump, loop.continuePos)
+		}
+
+	case *ast.LetStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.setSymbol(symbol)
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			c.emitUndefined(node.Value)
+			return nil
+		}
+
+		c.loadSymbol(symbol)
+
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		// 按照 key 在源码中的顺序编译，hash 保持插入的顺序
+		// 和求值器一样，每个 key 求值后马上检查，出错的位置是这个 key
+		for _, k := range node.Keys {
+			err := c.Compile(k)
+			if err != nil {
+				return err
+			}
+			c.pos = k.Pos()
+			c.emit(code.OpHashKey)
+			c.pos = node.Pos()
+
+			err = c.Compile(node.Pairs[k])
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		c.enterScope()
+
+		// 函数体中给自己的名字赋值时，名字指向外层的变量，和求值器一致
+		// 外层的变量在编译函数之前已经定义：顶层的名字由 declareGlobals 提前定义，
+		// 函数中的名字被内层函数赋值，在函数开始时装箱
+		if node.Name != "" && !assignsTo(node.Body, node.Name) {
+			c.symbolTable.DefineFunctionName(node.Name)
+		}
+
+		for _, p := range node.Parameters {
+			c.symbolTable.Define(p.Value)
+		}
+
+		// 函数开始时为需要装箱的变量创建 cell，参数装着传入的值，其他变量装着 null
+		for _, name := range capturedAssignments(node) {
+			symbol := c.symbolTable.DefineBoxed(name)
+			if symbol.Index < len(node.Parameters) {
+				c.emit(code.OpGetLocal, symbol.Index)
+			} else {
+				c.emit(code.OpNull)
+			}
+			c.emit(code.OpBox)
+			c.emit(code.OpSetLocal, symbol.Index)
+		}
+
+		err := c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+
+		// 最后一个表达式语句的值就是函数的返回值
+		if c.lastInstructionIs(code.OpPop) {
+			c.replaceLastPopWithReturn()
+		}
+		if !c.lastInstructionIs(code.OpReturnValue) {
+			c.emit(code.OpReturn)
+		}
+
+		freeSymbols := c.symbolTable.FreeSymbols
+		numLocals := c.symbolTable.numDefinitions
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
+		instructions := c.leaveScope()
+
+		// 捕获装箱的变量时捕获 cell 本身
+		for _, s := range freeSymbols {
+			c.loadSlot(s)
+		}
+
+		compiledFn := &object.CompiledFunction{
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
+		}
+
+		fnIndex := c.addConstant(compiledFn)
+		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		err = c.leaveTries(0)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return c.compileQuote(node)
+		}
+
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.MacroLiteral:
+		return fmt.Errorf("%s: macro literals can only be defined at the top level", node.Pos())
+
+	default:
+		return fmt.Errorf("%s: cannot compile %T", node.Pos(), node)
+	}
+
+	return nil
+}
+
+var infixOperators = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	">=": code.OpGreaterThanOrEqual,
+	"<":  code.OpLessThan,
+	"<=": code.OpLessThanOrEqual,
+}
+
+// 赋值表达式的值留在栈上
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(target.Value)
+		if !ok || symbol.Scope == BuiltinScope {
+			// 和求值器一样，先对右边求值，再报告变量没有定义
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpPop)
+			c.pos = target.Pos()
+			c.emitUndefined(target.Value)
+			return nil
+		}
+		// 会被赋值的自由变量都已经装箱，给自己名字赋值的函数也没有定义 FunctionScope
+		if symbol.Scope == FunctionScope || (symbol.Scope == FreeScope && !symbol.Boxed) {
+			return fmt.Errorf("%s: cannot assign to captured variable %s", target.Pos(), target.Value)
+		}
+
+		// 和求值器一样，读取没有赋值的变量时错误报告在变量的位置
+		if node.Operator != "=" {
+			c.pos = target.Pos()
+			c.loadSymbol(symbol)
+			c.pos = node.Pos()
+		}
+		err := c.compileAssignValue(node)
+		if err != nil {
+			return err
+		}
+
+		// 全局变量可能提前定义了但还没有赋值，这时和求值器一样报告变量没有定义
+		if symbol.Scope == GlobalScope {
+			c.pos = target.Pos()
+			c.emit(code.OpAssignGlobal, symbol.Index)
+		} else {
+			c.setSymbol(symbol)
+		}
+		c.loadSymbol(symbol)
+
+	case *ast.IndexExpression:
+		err := c.Compile(target.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(target.Index)
+		if err != nil {
+			return err
+		}
+
+		// 和求值器一致，读取和修改元素的错误报告在下标表达式的位置
+		c.pos = target.Pos()
+		if node.Operator != "=" {
+			c.emit(code.OpIndexKeep)
+		}
+		err = c.compileAssignValue(node)
+		if err != nil {
+			return err
+		}
+
+		c.pos = target.Pos()
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("%s: invalid assignment target %s", node.Pos(), node.Target.String())
+	}
+
+	return nil
+}
+
+// 编译赋值号右边的值；复合赋值时原来的值已经在栈上
+func (c *Compiler) compileAssignValue(node *ast.AssignExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	if node.Operator != "=" {
+		operator := strings.TrimSuffix(node.Operator, "=")
+		op, ok := infixOperators[operator]
+		if !ok {
+			return fmt.Errorf("%s: unknown operator %s", node.Pos(), node.Operator)
+		}
+		c.pos = node.Pos()
+		c.emit(op)
+	}
+	return nil
+}
+
+// 编译之前先定义程序顶层绑定的所有名字，函数可以引用在它之后才定义的全局变量，
+// 例如相互递归的函数。和求值器一样，执行到定义之前使用这些变量时，虚拟机报告变量没有定义。
+// 和内置函数同名的变量不提前定义，定义之前使用的仍然是内置函数
+func (c *Compiler) declareGlobals(program *ast.Program) {
+	declare := func(name string) {
+		if symbol, ok := c.symbolTable.Resolve(name); ok && symbol.Scope == BuiltinScope {
+			return
+		}
+		c.symbolTable.Define(name)
+	}
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral, *ast.MacroLiteral:
+			return false
+		case *ast.LetStatement:
+			declare(n.Name.Value)
+		case *ast.ForStatement:
+			declare(n.Variable.Value)
+		case *ast.TryExpression:
+			if n.CatchParameter != nil {
+				declare(n.CatchParameter.Value)
+			}
+		}
+		return true
+	})
+}
+
+// 迭代器保存在一个隐藏的变量中，名字不是合法的标识符，不会和用户的变量冲突
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	err := c.Compile(node.Iterable)
+	if err != nil {
+		return err
+	}
+	c.pos = node.Iterable.Pos()
+	c.emit(code.OpIterInit)
+
+	depth := len(c.scopes[c.scopeIndex].loops)
+	iterator := c.symbolTable.Define(fmt.Sprintf("<iterator%d>", depth))
+	c.setSymbol(iterator)
+
+	loop := c.enterLoop(len(c.currentInstructions()))
+
+	c.loadSymbol(iterator)
+	exitJumpPos := c.emit(code.OpIterNext, 9999)
+
+	variable := c.symbolTable.Define(node.Variable.Value)
+	c.setSymbol(variable)
+
+	err = c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loop.continuePos)
+
+	c.changeOperand(exitJumpPos, len(c.currentInstructions()))
+	c.leaveLoop()
+	c.emitLoopValue()
+	return nil
+}
+
+// 和求值器一样，循环的值是 null，作为最后一条语句时就是程序、块或者函数的值
+func (c *Compiler) emitLoopValue() {
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+}
+
+func (c *Compiler) enterLoop(continuePos int) *loopContext {
+	loop := &loopContext{continuePos: continuePos, tries: len(c.scopes[c.scopeIndex].tries)}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+	return loop
+}
+
+// 循环结束的位置确定后，回填 break 的跳转
+func (c *Compiler) leaveLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	endPos := len(c.currentInstructions())
+	for _, pos := range loop.breakJumps {
+		c.changeOperand(pos, endPos)
+	}
+}
+
+// try 块的值留在栈上，出错时 VM 把错误对象压栈并跳转到 catch
+// 有 finally 时 catch 块也在一个 OpTry 中，catch 中出错或者没有 catch 时，
+// 先把错误保存在隐藏的变量中，执行 finally 之后再重新抛出
+func (c *Compiler) compileTryExpression(node *ast.TryExpression) error {
+	try := &tryContext{handler: true, finally: node.Finally}
+	c.scopes[c.scopeIndex].tries = append(c.scopes[c.scopeIndex].tries, try)
+	depth := len(c.scopes[c.scopeIndex].tries)
+
+	tryPos := c.emit(code.OpTry, 9999)
+	err := c.Compile(node.Block)
+	if err != nil {
+		return err
+	}
+	c.leaveBlockValue()
+	c.emit(code.OpEndTry)
+	endJumps := []int{c.emit(code.OpJump, 9999)}
+
+	rethrowPos := tryPos
+	if node.Catch != nil {
+		c.changeOperand(tryPos, len(c.currentInstructions()))
+		c.emit(code.OpCatch)
+		if node.CatchParameter != nil {
+			symbol := c.symbolTable.Define(node.CatchParameter.Value)
+			c.setSymbol(symbol)
+		} else {
+			c.emit(code.OpPop)
+		}
+
+		try.handler = node.Finally != nil
+		if try.handler {
+			rethrowPos = c.emit(code.OpTry, 9999)
+		}
+
+		err = c.Compile(node.Catch)
+		if err != nil {
+			return err
+		}
+		c.leaveBlockValue()
+		if try.handler {
+			c.emit(code.OpEndTry)
+			endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+		}
+	}
+
+	// 编译 finally 时已经离开 try 块，但仍然占着这一层，finally 中的 try 不会用到同一个隐藏变量
+	try.handler = false
+	try.finally = nil
+	defer func() {
+		tries := c.scopes[c.scopeIndex].tries
+		c.scopes[c.scopeIndex].tries = tries[:len(tries)-1]
+	}()
+
+	if node.Finally != nil {
+		c.changeOperand(rethrowPos, len(c.currentInstructions()))
+		errSymbol := c.symbolTable.Define(fmt.Sprintf("<error%d>", depth))
+		c.setSymbol(errSymbol)
+		err = c.Compile(node.Finally)
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(errSymbol)
+		c.emit(code.OpThrow)
+	}
+
+	endPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, endPos)
+	}
+
+	if node.Finally != nil {
+		return c.Compile(node.Finally)
+	}
+	return nil
+}
+
+// 离开第 base 层之内的 try 块：由内向外撤销 OpTry，并执行 finally
+// 执行 finally 时它所在的 try 块已经离开，其中的 break 和 return 不会再次执行它
+func (c *Compiler) leaveTries(base int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= base; i-- {
+		if tries[i].handler {
+			c.emit(code.OpEndTry)
+		}
+		if tries[i].finally != nil {
+			c.scopes[c.scopeIndex].tries = tries[:i]
+			err := c.Compile(tries[i].finally)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 和求值器一样，quote 的参数不求值
+// 没有 unquote 时整个 quote 是一个 Quote 常量；有 unquote 时按照源码中的顺序编译 unquote 的参数，
+// 由 OpQuote 在运行时把它们的值转换为 AST，替换进 quote 的副本
+func (c *Compiler) compileQuote(node *ast.CallExpression) error {
+	if len(node.Arguments) != 1 {
+		return fmt.Errorf("%s: wrong number of arguments. got=%d, want=1", node.Pos(), len(node.Arguments))
+	}
+
+	quote := &object.Quote{Node: node.Arguments[0]}
+	calls := object.UnquoteCalls(quote.Node)
+	if len(calls) == 0 {
+		c.emit(code.OpConstant, c.addConstant(quote))
+		return nil
+	}
+
+	for _, call := range calls {
+		if len(call.Arguments) != 1 {
+			return fmt.Errorf("%s: wrong number of arguments. got=%d, want=1", call.Pos(), len(call.Arguments))
+		}
+		err := c.Compile(call.Arguments[0])
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpQuote, c.addConstant(quote), len(calls))
+	return nil
+}
+
+// && 和 || 编译成条件跳转，实现短路求值，结果总是布尔值
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	endJumps := []int{}
+	if node.Operator == "&&" {
+		// 左边为假时直接得到 false
+		leftFalsePos := c.emit(code.OpJumpNotTruthy, 9999)
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		rightFalsePos := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		falsePos := len(c.currentInstructions())
+		c.changeOperand(leftFalsePos, falsePos)
+		c.changeOperand(rightFalsePos, falsePos)
+		c.emit(code.OpFalse)
+	} else {
+		// 左边为真时直接得到 true
+		leftFalsePos := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		c.changeOperand(leftFalsePos, len(c.currentInstructions()))
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		rightFalsePos := c.emit(code.OpJumpNotTruthy, 9999)
+		c.emit(code.OpTrue)
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		c.changeOperand(rightFalsePos, len(c.currentInstructions()))
+		c.emit(code.OpFalse)
+	}
+
+	endPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, endPos)
+	}
+	return nil
+}
+
+// 块的值留在栈上：最后是表达式语句时去掉它的 OpPop，否则块没有值，压入 null
+func (c *Compiler) leaveBlockValue() {
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	switch {
+	case s.Boxed:
+		c.loadSlot(s)
+		c.emit(code.OpSetCell)
+	case s.Scope == GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	default:
+		c.emit(code.OpSetLocal, s.Index)
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	c.loadSlot(s)
+	if s.Boxed {
+		c.emit(code.OpGetCell)
+	}
+}
+
+// 读取变量所在的位置，装箱的变量得到的是 cell
+func (c *Compiler) loadSlot(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case FunctionScope:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+// 未定义的变量和求值器一样在执行到时才报错，可以被 try 捕获
+func (c *Compiler) emitUndefined(name string) {
+	c.emit(code.OpUndefined, c.addConstant(&object.String{Value: name}))
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// 生成一条指令，返回它的起始位置
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Add(posNewInstruction, c.pos)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	old := c.currentInstructions()
+	new := old[:last.Position]
+
+	c.scopes[c.scopeIndex].instructions = new
+	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+// 回填跳转指令的操作数
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
+
+// 编译的结果
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	SourceMap    code.SourceMap
+	GlobalNames  []string // 全局变量的名字，按照下标排列
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		GlobalNames:  c.symbolTable.GlobalNames(),
+	}
+}
@@ -0,0 +1,106 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+
+	a := global.Define("a")
+	if a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+
+	b := global.Define("b")
+	if b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+
+	// 重复定义沿用原来的位置
+	again := global.Define("a")
+	if again != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+
+	c := local.Define("c")
+	if c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+
+	d := local.Define("d")
+	if d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+}
+
+func TestResolveNestedLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("c")
+
+	tests := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{"len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FreeScope, Index: 0}},
+		{"c", Symbol{Name: "c", Scope: LocalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		result, ok := secondLocal.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v",
+				tt.name, tt.expected, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 {
+		t.Fatalf("wrong number of free symbols. got=%d", len(secondLocal.FreeSymbols))
+	}
+	expectedFree := Symbol{Name: "b", Scope: LocalScope, Index: 0}
+	if secondLocal.FreeSymbols[0] != expectedFree {
+		t.Errorf("wrong free symbol. want=%+v, got=%+v",
+			expectedFree, secondLocal.FreeSymbols[0])
+	}
+
+	if _, ok := secondLocal.Resolve("x"); ok {
+		t.Errorf("name x resolved, but was expected not to")
+	}
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v",
+			expected.Name, expected, result)
+	}
+}
@@ -1,106 +1,36 @@
 package evaluator
 
 import (
-	"fmt"
 	"monkey/object"
 )
 
 
 
 var builtins = map[string]*object.Builtin {
-	"len": { 
-		Fn: func(args ...object.Object) object.Object { 
-			if len(args) != 1 { 
-				return newError("wrong number of arguments. got=%d, want=1", 
-				len(args)) 
-			}
-			switch arg := args[0].(type) {
-			case *object.String:
-				return &object.Integer{
-					Value: int64(len(arg.Value)),
-				}
-			case *object.Array:
-				return &object.Integer{
-					Value: int64(len(arg.Elements)),
-				}
-			default: 
- 				return newError("argument to `len` not supported, got %s", args[0].Type())
-			}
-		}, 
-	},
-	"first": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 { 
-				return newError("wrong number of arguments. got=%d, want=1", len(args)) 
-			} 
-			if args[0].Type() != object.ARRAY_OBJ { 
-				return newError("argument to `first` must be ARRAY, got %s", args[0].Type()) 
-			} 
-			arr := args[0].(*object.Array) 
-			if len(arr.Elements) > 0 { 
-				return arr.Elements[0] 
-			}
-			return NULL
-		},
-	},
-	"last": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 1 { 
-				return newError("wrong number of arguments. got=%d, want=1", len(args)) 
-			} 
-			if args[0].Type() != object.ARRAY_OBJ { 
-				return newError("argument to `last` must be ARRAY, got %s", args[0].Type()) 
-			} 
-			arr := args[0].(*object.Array) 
-			length := len(arr.Elements) 
-			if length > 0 { 
-				return arr.Elements[length-1] 
-			} 
-			return NULL
-		},
-	},
-	"rest": { 
-		Fn: func(args ...object.Object) object.Object { 
-			if len(args) != 1 { 
-				return newError("wrong number of arguments. got=%d, want=1", 
-				len(args)) 
-			} 
-			if args[0].Type() != object.ARRAY_OBJ { 
-				return newError("argument to `rest` must be ARRAY, got %s", 
-				args[0].Type()) 
-			} 
-			arr := args[0].(*object.Array) 
-			length := len(arr.Elements) 
-			if length > 0 { 
-				newElements := make([]object.Object, length - 1) 
-				copy(newElements, arr.Elements[1:length]) 
-				return &object.Array{Elements: newElements} 
-			} 
-			return NULL 
-		}, 
-	},
-	"push": {
-		Fn: func(args ...object.Object) object.Object {
-			if len(args) != 2 { 
-				return newError("wrong number of arguments. got=%d, want=2", len(args)) 
-			} 
-			if args[0].Type() != object.ARRAY_OBJ { 
-				return newError("argument to `push` must be ARRAY, got %s", args[0].Type()) 
-			} 
-			arr := args[0].(*object.Array) 
-			length := len(arr.Elements) 
-			newElements := make([]object.Object, length+1) 
-			copy(newElements, arr.Elements) 
-			newElements[length] = args[1] 
-			return &object.Array{Elements: newElements}
-		},
-	},
-	"puts": {
-		Fn: func(args ...object.Object) object.Object {
-			for _, arg := range args {
-				fmt.Println(arg.Inspect())
-			}
-			return NULL
-		},
-	},
-} 
\ No newline at end of file
+	"len": object.GetBuiltinByName("len"),
+	"int": object.GetBuiltinByName("int"),
+	"float": object.GetBuiltinByName("float"),
+	"first": object.GetBuiltinByName("first"),
+	"last": object.GetBuiltinByName("last"),
+	"rest": object.GetBuiltinByName("rest"),
+	"push": object.GetBuiltinByName("push"),
+	"set": object.GetBuiltinByName("set"),
+	"keys": object.GetBuiltinByName("keys"),
+	"values": object.GetBuiltinByName("values"),
+	"entries": object.GetBuiltinByName("entries"),
+	"has": object.GetBuiltinByName("has"),
+	"put": object.GetBuiltinByName("put"),
+	"delete": object.GetBuiltinByName("delete"),
+	"merge": object.GetBuiltinByName("merge"),
+	"map": object.GetBuiltinByName("map"),
+	"filter": object.GetBuiltinByName("filter"),
+	"reduce": object.GetBuiltinByName("reduce"),
+	"sort": object.GetBuiltinByName("sort"),
+	"any": object.GetBuiltinByName("any"),
+	"all": object.GetBuiltinByName("all"),
+	"zip": object.GetBuiltinByName("zip"),
+	"range": object.GetBuiltinByName("range"),
+	"flatten": object.GetBuiltinByName("flatten"),
+	"throw": object.GetBuiltinByName("throw"),
+	"puts": object.GetBuiltinByName("puts"),
+}
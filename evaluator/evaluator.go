@@ -2,8 +2,11 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"strings"
 )
 
 
@@ -17,6 +20,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
@@ -24,8 +29,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right, env)
+		return withPos(evalPrefixExpression(node.Operator, right, env), node)
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -34,38 +42,54 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right, env)
+		return withPos(evalInfixExpression(node.Operator, left, right, env), node)
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.ReturnStatement:
-		value := Eval(node.ReturnValue, env)
+		value := evalTailExpression(node.ReturnValue, env)
 		if isError(value) {
 			return value
 		}
 		return &object.ReturnValue{
 			Value: value,
 		}
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	case *ast.LetStatement:
 		value := Eval(node.Value, env)
 		if isError(value) {
 			return value
 		}
-		env.Set(node.Name.Value, value)
+		env.Define(node.Name.Value, value)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 		return &object.Function{
+			Name: node.Name,
 			Parameters: params,
 			Body: body,
 			Env: env,
 		}
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
-			return quote(node.Arguments[0])
+			if len(node.Arguments) != 1 {
+				return withPos(newError("wrong number of arguments. got=%d, want=1", len(node.Arguments)), node)
+			}
+			return quote(node.Arguments[0], env)
 		}
 		function := Eval(node.Function, env)
 		if isError(function) {
@@ -75,7 +99,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) { 
 			return args[0] 
 		}
-		return applyFunction(function, args)
+		return withPos(applyFunction(function, args, env.Frame(), node.Pos()), node)
 	case *ast.StringLiteral:
 		return &object.String{
 			Value: node.Value,
@@ -85,7 +109,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(elements) == 1 && isError(elements[0]) { 
 			return elements[0] 
 		} 
-		return &object.Array{Elements: elements}
+		return object.NewArray(elements)
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -95,7 +119,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return withPos(evalIndexExpression(left, index), node)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 
@@ -109,9 +133,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 // 对null、boolean求值时会创建对象，避免重复创建对象，直接使用两个创建好的变量的引用来代替，提高性能
 var (
-	TRUE = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false} 
-	NULL = &object.Null{}
+	TRUE = object.TRUE
+	FALSE = object.FALSE
+	NULL = object.NULL
+
+	// 循环控制信号，不会作为值出现在程序中
+	BREAK = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean { 
@@ -130,6 +158,14 @@ func newError(format string, args ...interface{}) *object.Error {
 	}
 }
 
+// 给还没有位置信息的错误补上节点的位置，内层已经设置过的位置不会被覆盖
+func withPos(obj object.Object, node ast.Node) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return obj
+}
+
 func isError(obj object.Object) bool { 
 	if obj != nil { 
 		return obj.Type() == object.ERROR_OBJ 
@@ -151,7 +187,7 @@ func evalProgram(node *ast.Program, env *object.Environment) object.Object {
 		// }
 		switch result := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			return applyTailCall(result.Value)
 		case *object.Error:
 			return result
 		}
@@ -193,13 +229,14 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer, *object.BigInt:
+		return object.NegateInteger(right)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{
-		Value: -value,
-	}
 }
 
 func evalInfixExpression(
@@ -208,14 +245,17 @@ func evalInfixExpression(
 	env *object.Environment,
 ) object.Object {
 	switch {
-	case  left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+	case object.IsInteger(left) && object.IsInteger(right):
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// 整数和浮点数混合运算时，整数先转换为浮点数
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equals(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equals(left, right))
 	case left.Type() != right.Type(): 
  		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
@@ -223,44 +263,105 @@ func evalInfixExpression(
 	}
 }
 
+// 算术运算的除零和溢出由 object.IntegerArithmetic 处理
 func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
+	switch operator {
+	case "+", "-", "*", "/", "%":
+		return object.IntegerArithmetic(operator, left, right)
+	}
+	cmp := object.CompareIntegers(left, right)
+	switch operator {
+	case "<":
+		return nativeBoolToBooleanObject(cmp < 0)
+	case ">":
+		return nativeBoolToBooleanObject(cmp > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(cmp <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(cmp >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(cmp == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(cmp != 0)
+	default:
+		return  newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
 	switch operator {
 	case "+":
-		return &object.Integer{
-			Value: leftValue + rightValue,
-		}
+		return &object.Float{Value: leftValue + rightValue}
 	case "-":
-		return &object.Integer{
-			Value: leftValue - rightValue,
-		}
+		return &object.Float{Value: leftValue - rightValue}
 	case "*":
-		return &object.Integer{
-			Value: leftValue * rightValue,
-		}
+		return &object.Float{Value: leftValue * rightValue}
 	case "/":
-		return &object.Integer{
-			Value: leftValue / rightValue,
-		}
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
 	case "<":
 		return nativeBoolToBooleanObject(leftValue < rightValue)
 	case ">":
 		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
 	case "==":
 		return nativeBoolToBooleanObject(leftValue == rightValue)
 	case "!=":
 		return nativeBoolToBooleanObject(leftValue != rightValue)
 	default:
-		return  newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// 是否是数值类型：INTEGER、BIGINT 或者 FLOAT
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+// 把数值对象转换为 float64，调用前需要用 isNumber 判断
+func toFloat(obj object.Object) float64 {
+	if f, ok := obj.(*object.Float); ok {
+		return f.Value
+	}
+	return object.IntegerToFloat(obj)
+}
+
+// && 和 || 会短路：左边已经能决定结果时，不再对右边求值
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+	if node.Operator == "&&" && !isTruth(left) {
+		return FALSE
+	}
+	if node.Operator == "||" && isTruth(left) {
+		return TRUE
+	}
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruth(right))
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
 	if isTruth(condition) {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
@@ -270,6 +371,34 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
+// try 块出错时执行 catch 块，catch 的参数绑定到错误对应的 hash
+// finally 块总是执行，其中的错误、return、break 和 continue 会取代之前的结果
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := resolveTailCall(Eval(te.Block, env), env)
+	if errObj, ok := result.(*object.Error); ok && te.Catch != nil {
+		// 错误在当前函数中产生时，还没有经过 applyFunction 记下调用栈
+		if errObj.Stack == nil {
+			errObj.Stack = env.Frame()
+		}
+		if te.CatchParameter != nil {
+			env.Define(te.CatchParameter.Value, errObj.Hash())
+		}
+		result = resolveTailCall(Eval(te.Catch, env), env)
+	}
+
+	if te.Finally != nil {
+		finally := Eval(te.Finally, env)
+		if finally != nil {
+			ft := finally.Type()
+			if ft == object.RETURN_VALUE_OBJ || ft == object.ERROR_OBJ ||
+				ft == object.BREAK_OBJ || ft == object.CONTINUE_OBJ {
+				return finally
+			}
+		}
+	}
+	return result
+}
+
 func isTruth(condition object.Object) bool {
 	switch condition {
 	case NULL:
@@ -290,7 +419,8 @@ func evalBlockStatement(bs *ast.BlockStatement, env *object.Environment) object.
 		result = Eval(statement, env) 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		} 
@@ -298,6 +428,64 @@ func evalBlockStatement(bs *ast.BlockStatement, env *object.Environment) object.
  	return result
 }
 
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruth(condition) {
+			return NULL
+		}
+		if result, done := evalLoopBody(ws.Body, env); done {
+			return result
+		}
+	}
+}
+
+// 循环变量和 let 一样绑定在当前的环境中
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	var items []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		items = iterable.Elements()
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			items = append(items, pair.Key)
+		}
+	case *object.String:
+		for _, r := range iterable.Value {
+			items = append(items, &object.String{Value: string(r)})
+		}
+	default:
+		return withPos(newError("cannot iterate over %s", iterable.Type()), fs.Iterable)
+	}
+
+	for _, item := range items {
+		env.Define(fs.Variable.Value, item)
+		if result, done := evalLoopBody(fs.Body, env); done {
+			return result
+		}
+	}
+	return NULL
+}
+
+// 执行一次循环体，done 表示循环需要结束，此时 result 是循环语句的结果
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (result object.Object, done bool) {
+	result = Eval(body, env)
+	switch result.(type) {
+	case *object.ReturnValue, *object.Error:
+		return result, true
+	case *object.Break:
+		return NULL, true
+	}
+	return nil, false
+}
 
 func evalIdentifier(
 	node *ast.Identifier,
@@ -309,7 +497,7 @@ func evalIdentifier(
 	if builtin, ok := builtins[node.Value]; ok {
 		return builtin
 	}
-	return newError("identifier not found: " + node.Value)
+	return withPos(newError("identifier not found: " + node.Value), node)
 
 }
 
@@ -330,23 +518,118 @@ func evalExpressions(
 }
 
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// 函数调用的最大深度，超出时返回错误，而不是让 Go 的调用栈溢出
+var MaxCallDepth = 10000
+
+// 一次调用中连续的尾调用最多保留的栈帧数，超出后替换掉最内层的栈帧，只记下替换的次数，
+// 尾递归的内存占用保持有界
+const maxTailCallFrames = 100
+
+// caller 是调用者所在的栈帧，callPos 是调用处的位置
+// 尾调用不会递归地调用 applyFunction，而是在这里循环执行。和虚拟机一样，
+// 发起尾调用的函数仍然留在调用栈中，超出 maxTailCallFrames 之后合并为 "... N tail calls"
+func applyFunction(
+	fn object.Object,
+	args []object.Object,
+	caller *object.Frame,
+	callPos token.Position,
+) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendEnv)
-		return unwrapReturnValue(evaluated)
+		depth := 1
+		if caller != nil {
+			depth = caller.Depth + 1
+		}
+		if depth > MaxCallDepth {
+			return &object.Error{
+				Message: fmt.Sprintf("maximum call depth %d exceeded", MaxCallDepth),
+				Pos: callPos,
+				Stack: caller,
+			}
+		}
+		var frame *object.Frame
+		kept := 0 // 保留下来的尾调用栈帧个数
+		for {
+			if len(args) != len(fn.Parameters) {
+				err := newError("wrong number of arguments: want=%d, got=%d",
+					len(fn.Parameters), len(args))
+				// 尾调用的错误发生在发起尾调用的函数中，而不是最初的调用处
+				if frame != nil {
+					err.Pos = callPos
+					err.Stack = frame
+				}
+				return err
+			}
+			switch {
+			case frame == nil:
+				frame = &object.Frame{
+					Name: functionName(fn),
+					CallPos: callPos,
+					Caller: caller,
+					Depth: depth,
+				}
+			case kept < maxTailCallFrames:
+				kept++
+				frame = &object.Frame{
+					Name: functionName(fn),
+					CallPos: callPos,
+					Caller: frame,
+					Depth: frame.Depth + 1,
+				}
+			default:
+				frame = &object.Frame{
+					Name: functionName(fn),
+					CallPos: callPos,
+					Caller: frame.Caller,
+					Depth: frame.Depth,
+					TailCalls: frame.TailCalls + 1,
+				}
+			}
+			extendEnv := extendFunctionEnv(fn, args, frame)
+			evaluated := unwrapReturnValue(evalTailBlockStatement(fn.Body, extendEnv))
+			// 错误是在这个函数中产生的，记下当时的调用栈
+			if errObj, ok := evaluated.(*object.Error); ok && errObj.Stack == nil {
+				errObj.Stack = frame
+			}
+			tc, ok := evaluated.(*tailCall)
+			if !ok {
+				// 函数体为空或者最后一条语句是 let 时没有值，和虚拟机一样返回 null
+				if evaluated == nil {
+					return NULL
+				}
+				return evaluated
+			}
+			fn, args, callPos = tc.fn, tc.args, tc.pos
+		}
 	case *object.Builtin:
-		return fn.Fn(args...)
+		// 内置函数回调的函数和内置函数本身使用同一个调用者
+		call := func(callee object.Object, args ...object.Object) object.Object {
+			return applyFunction(callee, args, caller, callPos)
+		}
+		if result := fn.Call(call, args...); result != nil {
+			return result
+		}
+		return NULL
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(function *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnvironment(function.Env)
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+func extendFunctionEnv(
+	function *object.Function,
+	args []object.Object,
+	frame *object.Frame,
+) *object.Environment {
+	env := object.NewFunctionEnvironment(function.Env, frame)
 	for paramIndex, param := range function.Parameters {
-		env.Set(param.Value, args[paramIndex])
+		env.Define(param.Value, args[paramIndex])
 	}
 	return env
 }
@@ -359,14 +642,29 @@ func unwrapReturnValue(evaluated object.Object) object.Object {
 }
 
 
+// 字符串按照 Unicode 码点的顺序比较
 func evalStringInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
 	leftValue := left.(*object.String).Value
 	rightVlue := right.(*object.String).Value
-	return &object.String{
-		Value: leftValue + rightVlue,
+	switch operator {
+	case "+":
+		return &object.String{
+			Value: leftValue + rightVlue,
+		}
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightVlue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightVlue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightVlue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightVlue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightVlue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightVlue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
@@ -382,50 +680,133 @@ func evalIndexExpression(left object.Object, index object.Object) object.Object
 	}
 }
 
+// 赋值表达式的值就是赋给变量的值
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		if node.Operator != "=" {
+			current := evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+			value = withPos(evalCompoundOperator(node.Operator, current, value, env), node)
+			if isError(value) {
+				return value
+			}
+		}
+		if _, ok := env.Assign(target.Value, value); !ok {
+			return withPos(newError("identifier not found: "+target.Value), target)
+		}
+		return value
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
+		if node.Operator != "=" {
+			current := withPos(evalIndexExpression(left, index), target)
+			if isError(current) {
+				return current
+			}
+			value = withPos(evalCompoundOperator(node.Operator, current, value, env), node)
+			if isError(value) {
+				return value
+			}
+		}
+		return withPos(evalIndexAssignment(left, index, value), target)
+	default:
+		return withPos(newError("invalid assignment target %s", node.Target.String()), node)
+	}
+}
+
+// += 等复合赋值按照对应的二元运算求值
+func evalCompoundOperator(
+	operator string,
+	left, right object.Object,
+	env *object.Environment,
+) object.Object {
+	return evalInfixExpression(strings.TrimSuffix(operator, "="), left, right, env)
+}
+
+// 直接修改数组或者 hash 中的元素
+func evalIndexAssignment(left, index, value object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		arrayObject := left.(*object.Array)
+		idx := index.(*object.Integer).Value
+		if arrayObject.Frozen {
+			return newError("cannot modify %s used as hash key", left.Type())
+		}
+		if idx < 0 || idx >= int64(arrayObject.Len()) {
+			return newError("index out of range: %d", idx)
+		}
+		arrayObject.Set(int(idx), value)
+		return value
+	case left.Type() == object.HASH_OBJ:
+		hashObject := left.(*object.Hash)
+		if hashObject.Frozen {
+			return newError("cannot modify %s used as hash key", left.Type())
+		}
+		if !object.IsHashable(index) {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		hashObject.Set(index, value)
+		return value
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	max := int64(arrayObject.Len() - 1)
 	if idx < 0 || idx > max {
 		return NULL
 	} 
-	return arrayObject.Elements[idx]
+	return arrayObject.At(int(idx))
 }
 
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valueNode := range node.Pairs {
+	hash := &object.Hash{}
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+		if !object.IsHashable(key) {
+			return withPos(newError("unusable as hash key: %s", key.Type()), keyNode)
 		}
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{
-			Key: key,
-			Value: value,
-		}
+		hash.Set(key, value)
 	}
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
-	if !ok {
+	if !object.IsHashable(index) {
 		return newError("unusable as hash key: %s", index.Type())
 	}
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	value, ok := hashObject.Get(index)
 	if !ok {
 		return NULL
 	}
-	return pair.Value
+	return value
 }
\ No newline at end of file
@@ -1,9 +1,11 @@
 package evaluator
 
-import ( 
+import (
+	"monkey/internal/enginetest"
 	"monkey/lexer" 
 	"monkey/object" 
 	"monkey/parser" 
+	"runtime/debug"
 	"testing" 
 )
 
@@ -27,6 +29,9 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37}, 
 		{"3 * (3 * 3) + 10", 37}, 
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50}, 
+		{"10 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
 	}
 	
 	for _, tt := range tests { 
@@ -43,6 +48,18 @@ func testEval(input string) object.Object {
 	return Eval(program, env) 
 }
 
+// 和 testEval 一样，但源码有语法错误时让测试失败
+func testEvalChecked(t *testing.T, input string) object.Object {
+	t.Helper()
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if errors := p.Errors(); len(errors) > 0 {
+		t.Fatalf("parser errors for %q: %v", input, errors)
+	}
+	return Eval(program, object.NewEnvironment())
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool { 
 	result, ok := obj.(*object.Integer) 
 	if !ok { 
@@ -58,6 +75,94 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 
 
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"2 * 1.25 - 1", 1.5},
+		{"float(3)", 3},
+		{"float(\"2.25\")", 2.25},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestNumberConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3.99)", 3},
+		{"int(-3.99)", -3},
+		{"int(7)", 7},
+		{`int("42")`, 42},
+		{`int("4x")`, `could not parse "4x" as integer`},
+		{`int(true)`, "argument to `int` not supported, got BOOLEAN"},
+		{`float(true)`, "argument to `float` not supported, got BOOLEAN"},
+		{`int(1, 2)`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.0", "3.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"1e21", "1e+21"},
+		{"1.0 / 0", "+Inf"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect(). expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) { 
 	tests := []struct { 
 		input string 
@@ -73,6 +178,38 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false}, 
 		{"1 == 2", false}, 
 		{"1 != 2", true}, 
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 == 0.3", false},
+		{"2.5 != 2.5", false},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 >= 1", true},
+		{"5.5 % 2 == 1.5", true},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 > 0 && 2 > 0", true},
+		{"1 > 0 && 0 > 1 || 3 >= 3", true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"apple" < "banana"`, true},
+		{`"b" > "abc"`, true},
+		{`"a" <= "a"`, true},
+		{`"a" >= "b"`, false},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2, 3]] == [1, [2, 4]]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{"[1] == [1.0]", true},
+		{`{"a": [1], "b": 2} == {"b": 2, "a": [1]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`"1" == 1`, false},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b", true},
 	}
 	for _, tt := range tests { 
 		evaluated := testEval(tt.input) 
@@ -252,10 +389,30 @@ func TestErrorHandling(t *testing.T) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			"fn(a, b) { a + b; }(1);",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"1.5 + true",
+			"type mismatch: FLOAT + BOOLEAN",
+		},
+		{
+			"-\"a\"",
+			"unknown operator: -STRING",
+		},
 		{ 
 			`{"name": "Monkey"}[fn(x) { x }];`, 
 			"unusable as hash key: FUNCTION", 
 		},
+		{
+			"10 / 0",
+			"division by zero",
+		},
+		{
+			"let x = 0; 10 % x",
+			"division by zero",
+		},
 	}
 
 	for _, tt := range tests {
@@ -273,6 +430,47 @@ func TestErrorHandling(t *testing.T) {
 				tt.expectedMessage, errObj.Message)
 		}
 	}
+
+	enginetest.Run(t, enginetest.Errors, testEvalChecked)
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	defer func(mode object.OverflowMode) { object.Overflow = mode }(object.Overflow)
+
+	input := "9223372036854775807 + 1"
+
+	object.Overflow = object.OverflowWrap
+	testIntegerObject(t, testEval(input), -9223372036854775808)
+
+	object.Overflow = object.OverflowError
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned for %q", input)
+	}
+	if errObj.Message != "integer overflow: 9223372036854775807 + 1" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	object.Overflow = object.OverflowPromote
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input, "9223372036854775808"},
+		{"9223372036854775807 * 9223372036854775807", "85070591730234615847396907784232501249"},
+		{"let big = 9223372036854775807 + 1; big - 1", "9223372036854775807"},
+		{"let big = 9223372036854775807 + 1; big > 9223372036854775807", "true"},
+		{"-(9223372036854775807 + 1) - 1", "-9223372036854775809"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: got=%s (%T), want=%s", tt.input, evaluated.Inspect(), evaluated, tt.expected)
+		}
+	}
+
+	// 结果回到 int64 范围内时还原为 INTEGER
+	testIntegerObject(t, testEval("(9223372036854775807 + 1) - 1"), 9223372036854775807)
 }
 
 func TestLetStatements(t *testing.T) {
@@ -292,6 +490,88 @@ func TestLetStatements(t *testing.T) {
 }
 
 
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a = 10; a;", 10},
+		{"let a = 5; a = a * 2;", 10},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let a = 5; a += 2; a;", 7},
+		{"let a = 5; a -= 2; a;", 3},
+		{"let a = 5; a *= 2; a;", 10},
+		{"let a = 5; a /= 2; a;", 2},
+		{"let a = 5; a %= 2; a;", 1},
+		// 修改的是外层环境中的绑定
+		{"let a = 1; let f = fn() { a = 2; }; f(); a;", 2},
+		{"let a = 1; let f = fn(a) { a = 2; }; f(5); a;", 1},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a[0];", 10},
+		{"let a = [1, 2, 3]; a[1] += 5; a[1];", 7},
+		{"let a = [1, 2, 3]; let b = a; b[2] = 9; a[2];", 9},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"];`, 2},
+		{`let h = {}; h["b"] = 3; h["b"];`, 3},
+		{`let h = {"a": 1}; h["a"] *= 10; h["a"];`, 10},
+		{"let a = [[1], [2]]; a[1][0] = 5; a[1][0];", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAssignErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let h = {}; h[fn(x) { x }] = 1;", "unusable as hash key: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	enginetest.Run(t, enginetest.AssignErrors, testEvalChecked)
+}
+
+func TestAssignCapturedVariables(t *testing.T) {
+	enginetest.Run(t, enginetest.AssignCapturedVariables, testEvalChecked)
+}
+
+func TestGlobalForwardReferences(t *testing.T) {
+	enginetest.Run(t, enginetest.GlobalForwardReferences, testEvalChecked)
+}
+
+func TestLoops(t *testing.T) {
+	enginetest.Run(t, enginetest.Loops, testEvalChecked)
+}
+
+
+func TestTryCatch(t *testing.T) {
+	enginetest.Run(t, enginetest.TryCatch, testEvalChecked)
+}
 
 func TestFunctionApplication(t *testing.T) { 
 	tests := []struct { 
@@ -310,6 +590,192 @@ func TestFunctionApplication(t *testing.T) {
 	} 
 }
 
+func TestClosures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let newAdder = fn(x) { fn(y) { x + y }; }; let addTwo = newAdder(2); addTwo(3);", 5},
+		{"let a = 10; let f = fn() { a }; f();", 10},
+		{"let a = 10; let f = fn(a) { a }; f(1) + a;", 11},
+		{"let f = fn(x) { if (x == 0) { 0 } else { x + f(x - 1) } }; f(10);", 55},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c();", 3},
+		{"let a = 1; let f = fn() { let a = 2; a }; f() + a;", 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// 限制 Go 调用栈的大小，没有尾调用优化时这些递归会超出限制
+	defer debug.SetMaxStack(debug.SetMaxStack(4 << 20))
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(100000, 0);", 100000},
+		{"let count = fn(n) { if (n == 0) { return 0; } return count(n - 1); }; count(100000);", 0},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+		let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+		even(100001);`, false},
+		{"let loop = fn(n) { while (true) { if (n == 0) { return 42; } return loop(n - 1); } }; loop(100000);", 42},
+		// 非尾部位置的调用照常执行
+		{"let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(100);", 100},
+		{"let f = fn(x) { x * 2 }; return f(21);", 42},
+		{"let f = fn(x) { len(x) }; f([1, 2, 3]);", 3},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+
+	// 尾调用的错误报告在尾调用的位置，发起尾调用的函数和之前被尾调用的函数都留在调用栈中
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(a, b) { a };\nlet g = fn() { f(1) };\ng();",
+			"Error: 2:17: wrong number of arguments: want=2, got=1\n\tat g (3:2)"},
+		{"let h = fn(a) { a };\nlet g = fn() { h() };\nlet f = fn() { g() };\nf();",
+			"Error: 2:17: wrong number of arguments: want=1, got=0\n\tat g (3:17)\n\tat f (4:2)"},
+		{"let g = fn() { 1(2) };\ng();",
+			"Error: 1:17: not a function: INTEGER\n\tat g (2:2)"},
+		{"let f = fn(n) { if (n == 0) { f(1, 2) } else { f(n - 1) } };\nf(3);",
+			"Error: 1:32: wrong number of arguments: want=1, got=2\n\tat f (1:49)\n\tat f (1:49)\n\tat f (1:49)\n\tat f (2:2)"},
+	}
+	for _, tt := range errorTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("%q: no error object returned", tt.input)
+		}
+		if errObj.Traceback() != tt.expected {
+			t.Errorf("%q: wrong traceback.\nwant=%q\ngot =%q", tt.input, tt.expected, errObj.Traceback())
+		}
+	}
+
+	// 超出 maxTailCallFrames 的尾调用合并为一项，尾递归的调用栈不会无限增长
+	evaluated := testEval(`let f = fn(n) { if (n == 0) { throw("x") } else { f(n - 1) } };
+	try { f(200) } catch (e) { let s = e["stack"]; [len(s), s[0], s[1], s[len(s) - 1]] }`)
+	expected := "[102, f (1:52), ... 100 tail calls, f (2:9)]"
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong stack of collapsed tail calls. want=%s, got=%s", expected, evaluated.Inspect())
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	evaluated := testEval("let f = fn(n) { 1 + f(n + 1) }; f(0);")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "maximum call depth 10000 exceeded" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	if errObj.Pos.String() != "1:22" {
+		t.Errorf("wrong error position. got=%q", errObj.Pos.String())
+	}
+	if errObj.Stack == nil || errObj.Stack.Depth != 10000 {
+		t.Fatalf("wrong stack. got=%+v", errObj.Stack)
+	}
+
+	defer func(depth int) { MaxCallDepth = depth }(MaxCallDepth)
+	MaxCallDepth = 3
+
+	evaluated = testEval("let f = fn(n) { 1 + f(n + 1) };\nlet g = fn() { let x = f(0); x };\ng();")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "maximum call depth 3 exceeded" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+	expected := []struct {
+		name string
+		pos  string
+	}{
+		{"f", "1:22"},
+		{"f", "2:25"},
+		{"g", "3:2"},
+	}
+	frame := errObj.Stack
+	for _, tt := range expected {
+		if frame == nil {
+			t.Fatalf("stack is too short")
+		}
+		if frame.Name != tt.name || frame.CallPos.String() != tt.pos {
+			t.Errorf("wrong frame. want=%s (%s), got=%s (%s)", tt.name, tt.pos, frame.Name, frame.CallPos)
+		}
+		frame = frame.Caller
+	}
+	if frame != nil {
+		t.Errorf("stack is too long")
+	}
+
+	// 尾调用不会增加调用深度
+	testIntegerObject(t, testEval("let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10);"), 0)
+	testIntegerObject(t, testEval("let f = fn() { fn() { 1 }() + 1 }; f();"), 2)
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let check = fn(x) {
+  if (x > 2) { x + true } else { x }
+};
+let run = fn(items) {
+  let total = 0;
+  for (i in items) { total += check(i); }
+  total
+};
+let wrapper = fn() { let r = fn() { run([1, 2, 3]) }(); r };
+wrapper();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Pos.String() != "2:18" {
+		t.Errorf("wrong error position. got=%q", errObj.Pos.String())
+	}
+
+	expected := "Error: 2:18: type mismatch: INTEGER + BOOLEAN\n" +
+		"\tat check (6:36)\n" +
+		// 匿名函数对 run 的调用是尾调用，和虚拟机一样，匿名函数的栈帧还在
+		"\tat run (9:40)\n" +
+		"\tat <anonymous> (9:53)\n" +
+		"\tat wrapper (10:8)"
+	if errObj.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot =%q", expected, errObj.Traceback())
+	}
+
+	// 顶层产生的错误没有调用栈
+	evaluated = testEval("let f = fn() { 1 }; f() + true;")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Stack != nil {
+		t.Errorf("top-level error should have no stack. got=%+v", errObj.Stack)
+	}
+
+	// 参数个数不对的错误发生在调用者中
+	evaluated = testEval("let f = fn(a, b) { a };\nlet g = fn() { f(1) + 1 };\ng();")
+	errObj, ok = evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected = "Error: 2:17: wrong number of arguments: want=2, got=1\n\tat g (3:2)"
+	if errObj.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot =%q", expected, errObj.Traceback())
+	}
+}
+
 func TestStringLiteral(t *testing.T) { 
 	input := `"Hello World!"` 
 	evaluated := testEval(input) 
@@ -323,6 +789,19 @@ func TestStringLiteral(t *testing.T) {
 }
 
 
+func TestStringEscapes(t *testing.T) {
+	input := "\"a\\tb\\n\" + `c\\d`"
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "a\tb\nc\\d" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+
 func TestStringConcatenation(t *testing.T) { 
 	// 字符串拼接
 	input := `"Hello" + " " + "World!"` 
@@ -347,6 +826,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("hello world")`, 11}, 
 		{`len(1)`, "argument to `len` not supported, got INTEGER"}, 
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"}, 
+		{`len("你好")`, 2},
+		{`len("héllo")`, 5},
 	} 
 	for _, tt := range tests { 
 		evaluated := testEval(tt.input)
@@ -369,6 +850,18 @@ func TestBuiltinFunctions(t *testing.T) {
 }
 
 
+func TestHashBuiltins(t *testing.T) {
+	enginetest.Run(t, enginetest.HashBuiltins, testEvalChecked)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	enginetest.Run(t, enginetest.CollectionBuiltins, testEvalChecked)
+}
+
+func TestArrayValueSemantics(t *testing.T) {
+	enginetest.Run(t, enginetest.ArrayValueSemantics, testEvalChecked)
+}
+
 func TestArrayLiterals(t *testing.T) { 
 	input := "[1, 2 * 2, 3 + 3]" 
 	evaluated := testEval(input) 
@@ -376,13 +869,13 @@ func TestArrayLiterals(t *testing.T) {
 	if !ok { 
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated) 
 	} 
-	if len(result.Elements) != 3 { 
+	if result.Len() != 3 { 
 		t.Fatalf("array has wrong num of elements. got=%d", 
-		len(result.Elements)) 
+		result.Len()) 
 	} 
-	testIntegerObject(t, result.Elements[0], 1) 
-	testIntegerObject(t, result.Elements[1], 4) 
-	testIntegerObject(t, result.Elements[2], 6) 
+	testIntegerObject(t, result.At(0), 1) 
+	testIntegerObject(t, result.At(1), 4) 
+	testIntegerObject(t, result.At(2), 6) 
 }
 
 
@@ -460,27 +953,38 @@ func TestHashLiterals(t *testing.T) {
 	if !ok { 
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated) 
 	} 
-	expected := map[object.HashKey]int64{ 
-		(&object.String{Value: "one"}).HashKey(): 1, 
-		(&object.String{Value: "two"}).HashKey(): 2, 
-		(&object.String{Value: "three"}).HashKey(): 3, 
-		(&object.Integer{Value: 4}).HashKey(): 4, 
-		TRUE.HashKey(): 5, 
-		FALSE.HashKey(): 6, 
-	} 
-	if len(result.Pairs) != len(expected) { 
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs)) 
-	} 
-	for expectedKey, expectedValue := range expected { 
-		pair, ok := result.Pairs[expectedKey] 
-		if !ok { 
-			t.Errorf("no pair for given key in Pairs") 
-		} 
-		testIntegerObject(t, pair.Value, expectedValue) 
-	} 
+	// 键值对按照插入的顺序排列
+	expected := []struct {
+		key   object.Object
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+	}
+	for i, pair := range result.Pairs() {
+		if !object.Equals(pair.Key, expected[i].key) {
+			t.Errorf("pairs[%d] has wrong key. want=%s, got=%s", i, expected[i].key.Inspect(), pair.Key.Inspect())
+		}
+		testIntegerObject(t, pair.Value, expected[i].value)
+	}
 }
 
 
+func TestHashOrder(t *testing.T) {
+	enginetest.Run(t, enginetest.HashOrder, testEvalChecked)
+}
+
+func TestCompositeHashKeys(t *testing.T) {
+	enginetest.Run(t, enginetest.CompositeHashKeys, testEvalChecked)
+}
+
 func TestHashIndexExpressions(t *testing.T) { 
 	tests := []struct { 
 		input string 
@@ -524,4 +1028,48 @@ func TestHashIndexExpressions(t *testing.T) {
 			testNullObject(t, evaluated) 
 		} 
 	} 
-}
\ No newline at end of file
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedPos string
+	}{
+		{"5 + true;", "1:3"},
+		{"let a = 1;\n  -true", "2:3"},
+		{"let f = fn(x) {\n  x + true\n};\nf(1);", "2:5"},
+		{"\nfoobar", "2:1"},
+		{`len(1)`, "1:4"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "1:19"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.String() != tt.expectedPos {
+			t.Errorf("wrong error position for %q. expected=%q, got=%q",
+				tt.input, tt.expectedPos, errObj.Pos.String())
+		}
+	}
+}
+
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let 问候 = fn(名字) { "你好，" + 名字 }; 问候("世界")`
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "你好，世界" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+
+func TestLogicalShortCircuit(t *testing.T) {
+	enginetest.Run(t, enginetest.LogicalShortCircuit, testEvalChecked)
+}
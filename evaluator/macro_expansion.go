@@ -0,0 +1,134 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// 找出程序顶层的 let name = macro(...) 定义，存入 env，并从程序中移除
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	definitions := []int{}
+
+	for i, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	for i := len(definitions) - 1; i >= 0; i = i - 1 {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok {
+		return false
+	}
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+	env.Define(letStatement.Name.Value, macro)
+}
+
+// 展开程序中所有的宏调用：参数不求值，以 quote 的形式传给宏，
+// 宏必须返回 quote，返回的 AST 替换掉原来的调用
+// 出错时返回第一个错误，程序可能只被展开了一部分
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, error) {
+	var expandErr error
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if expandErr != nil {
+			return node
+		}
+		callExpression, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		macro, ok := isMacroCall(callExpression, env)
+		if !ok {
+			return node
+		}
+		if len(callExpression.Arguments) != len(macro.Parameters) {
+			expandErr = fmt.Errorf("%s: wrong number of arguments to macro %s. got=%d, want=%d",
+				callExpression.Pos(), callExpression.Function, len(callExpression.Arguments), len(macro.Parameters))
+			return node
+		}
+
+		args := quoteArgs(callExpression)
+		evalEnv := extendMacroEnv(macro, args)
+
+		evaluated := Eval(macro.Body, evalEnv)
+		evaluated = applyTailCall(unwrapReturnValue(evaluated))
+		if errObj, ok := evaluated.(*object.Error); ok {
+			expandErr = fmt.Errorf("%s: error expanding macro %s: %s",
+				callExpression.Pos(), callExpression.Function, errObj.Message)
+			return node
+		}
+
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			expandErr = fmt.Errorf("%s: macro %s must return a quote, got %s",
+				callExpression.Pos(), callExpression.Function, typeOf(evaluated))
+			return node
+		}
+		// 展开的结果放进程序中，之后可能被修改，不能和 quote 共用节点
+		return ast.Copy(quote.Node)
+	})
+	return expanded, expandErr
+}
+
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+	return macro, true
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+	return args
+}
+
+func extendMacroEnv(macro *object.Macro, args []*object.Quote) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+	for paramIdx, param := range macro.Parameters {
+		extended.Define(param.Value, args[paramIdx])
+	}
+	return extended
+}
+
+// 宏体可能没有返回值
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return obj.Type()
+}
@@ -5,9 +5,27 @@ import (
 	"monkey/object"
 )
 
+// quote 不对参数求值，而是直接返回 AST；其中的 unquote(...) 会按照源码中的顺序求值，
+// 结果再转换回 AST 节点替换掉 unquote 调用。替换在复制的 AST 上进行，不会修改函数体
+func quote(node ast.Node, env *object.Environment) object.Object {
+	calls := object.UnquoteCalls(node)
+	values := make([]object.Object, 0, len(calls))
+	for _, call := range calls {
+		if len(call.Arguments) != 1 {
+			return withPos(newError("wrong number of arguments. got=%d, want=1", len(call.Arguments)), call)
+		}
+		unquoted := Eval(call.Arguments[0], env)
+		if isError(unquoted) {
+			return unquoted
+		}
+		values = append(values, unquoted)
+	}
 
-func quote(node ast.Node) object.Object {
+	quoted, err := object.Unquote(node, values)
+	if err != nil {
+		return err
+	}
 	return &object.Quote{
-		Node: node,
+		Node: quoted,
 	}
-}
\ No newline at end of file
+}
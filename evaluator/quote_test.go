@@ -2,6 +2,8 @@ package evaluator
 
 import ( 
 	"testing" 
+	"monkey/ast"
+	"monkey/internal/enginetest"
 	"monkey/object" 
 ) 
 
@@ -42,6 +44,8 @@ import (
 			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected) 
 		} 
 	} 
+
+	enginetest.Run(t, enginetest.Quote, testEvalChecked)
 }
 
 
@@ -66,6 +70,45 @@ func TestQuoteUnquote(t *testing.T) {
 		`quote(unquote(4 + 4) + 8)`, 
 		`(8 + 8)`, 
 		}, 
+		{
+		`let foobar = 8;
+		quote(foobar)`,
+		`foobar`,
+		},
+		{
+		`let foobar = 8;
+		quote(unquote(foobar))`,
+		`8`,
+		},
+		{
+		`quote(unquote(true))`,
+		`true`,
+		},
+		{
+		`quote(unquote(true == false))`,
+		`false`,
+		},
+		{
+		`quote(unquote(quote(4 + 4)))`,
+		`(4 + 4)`,
+		},
+		{
+		`let quotedInfixExpression = quote(4 + 4);
+		quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
+		`(8 + (4 + 4))`,
+		},
+		{
+		`quote(unquote(1.5 * 2) + unquote("a" + "b"))`,
+		`(3.0 + ab)`,
+		},
+		{
+		`quote(unquote([1, 2]))`,
+		`[1, 2]`,
+		},
+		{
+		`quote(unquote({"a": [true, 1.5]}) + unquote([quote(x + 1)]))`,
+		`({a:[true, 1.5]} + [(x + 1)])`,
+		},
 	} 
 	for _, tt := range tests { 
 		evaluated := testEval(tt.input) 
@@ -80,4 +123,80 @@ func TestQuoteUnquote(t *testing.T) {
 			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected) 
 		} 
 	} 
-}
\ No newline at end of file
+}
+
+func TestQuoteInFunction(t *testing.T) {
+	// 每次调用都在函数体的副本上替换 unquote，不会影响下一次调用
+	input := `let f = fn(x) { quote(unquote(x) + 1) }; [f(1), f(2)]`
+	expected := "[Quote((1 + 1)), Quote((2 + 1))]"
+
+	evaluated := testEval(input)
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), expected)
+	}
+}
+
+func TestUnquoteQuoteCopies(t *testing.T) {
+	// 同一个 quote 替换进两个位置，两处的节点互不共用
+	evaluated := testEval(`let x = quote(1 + 2); quote(unquote(x) * unquote(x))`)
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		t.Fatalf("expected *object.Quote. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	infix, ok := quote.Node.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("quote.Node is not *ast.InfixExpression. got=%T", quote.Node)
+	}
+	infix.Left.(*ast.InfixExpression).Operator = "-"
+
+	expected := "((1 - 2) * (1 + 2))"
+	if quote.Node.String() != expected {
+		t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(nope) + 1)`, "1:15: identifier not found: nope"},
+		{`puts(quote(unquote(nope) + 1))`, "1:20: identifier not found: nope"},
+		{`quote(unquote(if (false) { 1 }))`, "1:14: cannot unquote NULL"},
+		{`quote(unquote(fn(x) { x }))`, "1:14: cannot unquote FUNCTION"},
+		{`quote(unquote([1, puts]))`, "1:14: cannot unquote BUILTIN"},
+		{`quote(unquote({"a": fn() {}}))`, "1:14: cannot unquote FUNCTION"},
+		{`quote(1 + unquote(1 / 0))`, "1:21: division by zero"},
+		{`quote(unquote(1, 2))`, "1:14: wrong number of arguments. got=2, want=1"},
+		{`quote(1 + unquote())`, "1:18: wrong number of arguments. got=0, want=1"},
+		// 按照源码中的顺序求值，报告第一个错误
+		{`quote({unquote(a): 1, unquote(b): 2, unquote(c): 3})`, "1:16: identifier not found: a"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: expected *object.Error. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if got := errObj.Pos.String() + ": " + errObj.Message; got != tt.expected {
+			t.Errorf("%q: wrong error. got=%q, want=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestUnquoteBigInt(t *testing.T) {
+	defer func(mode object.OverflowMode) { object.Overflow = mode }(object.Overflow)
+	object.Overflow = object.OverflowPromote
+
+	evaluated := testEval(`quote(unquote(9223372036854775807 + 1))`)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected *object.Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "cannot unquote BIGINT" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"monkey/token"
+)
+
+// 尾调用优化
+// 函数体最后一个表达式以及 return 的表达式处于尾部位置，如果它是对 Monkey 函数的调用，
+// 不在这里调用，而是返回一个 tailCall，由外层 applyFunction 的循环接着执行，
+// 这样尾递归不会让 Go 的调用栈增长
+
+const TAIL_CALL_OBJ = "TAIL_CALL"
+
+// 等待执行的尾调用，只在求值器内部传递，不会作为值出现在程序中
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+	pos  token.Position // 调用处的位置
+}
+
+func (tc *tailCall) Type() object.ObjectType { return TAIL_CALL_OBJ }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// 和 evalBlockStatement 相同，但最后一条语句处于尾部位置
+func evalTailBlockStatement(bs *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+	for i, statement := range bs.Statements {
+		if i == len(bs.Statements)-1 {
+			if es, ok := statement.(*ast.ExpressionStatement); ok {
+				return evalTailExpression(es.Expression, env)
+			}
+		}
+		result = Eval(statement, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+// 对处于尾部位置的表达式求值，调用 Monkey 函数时返回 tailCall
+func evalTailExpression(exp ast.Expression, env *object.Environment) object.Object {
+	switch node := exp.(type) {
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return Eval(node, env)
+		}
+		function := Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		if fn, ok := function.(*object.Function); ok {
+			return &tailCall{fn: fn, args: args, pos: node.Pos()}
+		}
+		return withPos(applyFunction(function, args, env.Frame(), node.Pos()), node)
+	case *ast.IfExpression:
+		condition := Eval(node.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruth(condition) {
+			return evalTailBlockStatement(node.Consequence, env)
+		} else if node.Alternative != nil {
+			return evalTailBlockStatement(node.Alternative, env)
+		}
+		return NULL
+	default:
+		return Eval(exp, env)
+	}
+}
+
+// 在函数之外遇到的尾调用（例如顶层的 return f(x)），直接执行
+func applyTailCall(obj object.Object) object.Object {
+	if tc, ok := obj.(*tailCall); ok {
+		return applyFunction(tc.fn, tc.args, nil, tc.pos)
+	}
+	return obj
+}
+
+// try 块中的 return f(x) 不处于尾部位置，需要在 try 块之内执行，才能捕获其中的错误
+func resolveTailCall(obj object.Object, env *object.Environment) object.Object {
+	rv, ok := obj.(*object.ReturnValue)
+	if !ok {
+		return obj
+	}
+	tc, ok := rv.Value.(*tailCall)
+	if !ok {
+		return obj
+	}
+	value := applyFunction(tc.fn, tc.args, env.Frame(), tc.pos)
+	if isError(value) {
+		return value
+	}
+	return &object.ReturnValue{Value: value}
+}
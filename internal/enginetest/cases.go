@@ -0,0 +1,248 @@
+package enginetest
+
+// 运行时错误的信息和位置
+var Errors = []Case{
+	{"5 + true;", "Error: 1:3: type mismatch: INTEGER + BOOLEAN"},
+	{"-true", "Error: 1:1: unknown operator: -BOOLEAN"},
+	{"true + false;", "Error: 1:6: unknown operator: BOOLEAN + BOOLEAN"},
+	{`"Hello" - "World"`, "Error: 1:9: unknown operator: STRING - STRING"},
+	{`{[fn(x) { x }]: 2}`, "Error: 1:2: unusable as hash key: ARRAY"},
+	{"1[0]", "Error: 1:2: index operator not supported: INTEGER"},
+	{"let a = 1; a();", "Error: 1:13: not a function: INTEGER"},
+	{`len(1)`, "Error: 1:4: argument to `len` not supported, got INTEGER"},
+	{`len("one", "two")`, "Error: 1:4: wrong number of arguments. got=2, want=1"},
+	{"10 / 0", "Error: 1:4: division by zero"},
+	{"let x = 0; 10 % x", "Error: 1:15: division by zero"},
+	{"foobar", "Error: 1:1: identifier not found: foobar"},
+	{"let f = fn() { b }; f()", "Error: 1:16: identifier not found: b"},
+	{"fn(a, b) { a + b; }(1);", "Error: 1:20: wrong number of arguments: want=2, got=1"},
+}
+
+var AssignErrors = []Case{
+	{"x = 1;", "Error: 1:1: identifier not found: x"},
+	{"x += 1;", "Error: 1:1: identifier not found: x"},
+	{"len = 1;", "Error: 1:1: identifier not found: len"},
+	{"let a = 1; a += true;", "Error: 1:14: type mismatch: INTEGER + BOOLEAN"},
+	{"let a = [1]; a[1] = 2;", "Error: 1:15: index out of range: 1"},
+	{"let a = [1]; a[-1] = 2;", "Error: 1:15: index out of range: -1"},
+	{`let s = "abc"; s[0] = "x";`, "Error: 1:17: index assignment not supported: STRING"},
+	{`let h = {}; h["a"] += 1;`, "Error: 1:20: type mismatch: NULL + INTEGER"},
+}
+
+// quote 的参数不求值，变量不需要定义
+var Quote = []Case{
+	{`quote(5)`, "Quote(5)"},
+	{`quote(5 + 8)`, "Quote((5 + 8))"},
+	{`quote(foobar)`, "Quote(foobar)"},
+	{`let f = fn(x) { quote(x + y) }; f(1)`, "Quote((x + y))"},
+	{`let q = quote(1); q == q`, "true"},
+	{`let x = 5; quote(unquote(x) + 1)`, "Quote((5 + 1))"},
+	{`let x = 5; puts(quote(unquote(x) + 1))`, "null"},
+	{`quote(unquote(quote(a + b)) * unquote(2 > 1))`, "Quote(((a + b) * true))"},
+	{`let f = fn(x) { quote(unquote(x) + 1) }; [f(1), f(2)]`, "[Quote((1 + 1)), Quote((2 + 1))]"},
+	{`quote({unquote(a): 1, unquote(b): 2})`, "Error: 1:16: identifier not found: a"},
+	{`quote(unquote(len))`, "Error: 1:14: cannot unquote BUILTIN"},
+}
+
+var LogicalShortCircuit = []Case{
+	// 右边如果被求值会产生错误
+	{"false && foobar", "false"},
+	{"true || foobar", "true"},
+	{"false && (1 + true)", "false"},
+	{"true || (1 + true)", "true"},
+	{"let f = fn() { 1 + true }; false && f()", "false"},
+	{"let f = fn() { 1 + true }; 1 || f()", "true"},
+	{"true && foobar", "Error: 1:9: identifier not found: foobar"},
+}
+
+var Loops = []Case{
+	{"let i = 0; while (i < 10) { i += 1; } i;", "10"},
+	{"let i = 0; while (false) { i += 1; } i;", "0"},
+	{"let i = 0; while (true) { i += 1; if (i == 5) { break; } } i;", "5"},
+	{"let i = 0; let s = 0; while (i < 10) { i += 1; if (i % 2 == 0) { continue; } s += i; } s;", "25"},
+	{"let s = 0; for (x in [1, 2, 3]) { s += x; } s;", "6"},
+	{"for (x in [1, 2, 3]) { } x;", "3"},
+	{`let s = 0; for (k in {1: "a", 2: "b", 3: "c"}) { s += k; } s;`, "6"},
+	{`let n = 0; for (c in "héllo") { n += 1; } n;`, "5"},
+	{`let s = ""; for (c in "héllo") { s = c + s; } s;`, "olléh"},
+	{"let s = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } s += x; } s;", "3"},
+	{"let s = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { continue; } s += x; } s;", "7"},
+	{"let s = 0; for (a in [1, 2]) { for (b in [10, 20]) { if (b == 20) { break; } s += a * b; } } s;", "30"},
+	{"let f = fn() { let i = 0; while (true) { i += 1; if (i > 3) { return i * 10; } } }; f();", "40"},
+	{"let f = fn(arr) { for (x in arr) { if (x > 1) { return x; } } 0 }; f([1, 5, 7]);", "5"},
+	{"let f = fn(arr) { let s = 0; for (x in arr) { s += x; } s }; f([1, 2]) + f([3]);", "6"},
+	{"let s = 0; while (s < 3) { s += 1 }; s", "3"},
+	{"let s = 0; for (x in [1, 2]) { s += x }; s", "3"},
+	// 循环的值是 null
+	{"let i = 0; while (i < 2) { i += 1 }", "null"},
+	{"for (x in [1]) { x }", "null"},
+	{"while (true) { break }", "null"},
+	{"if (true) { for (x in [1]) { } }", "null"},
+	// 循环作为函数的最后一条语句时，函数返回 null
+	{"fn() { while (true) { break } }()", "null"},
+	{"fn() { while (false) { } }()", "null"},
+	{"fn() { for (x in [1]) { } }()", "null"},
+	{"fn() { let x = 1 }()", "null"},
+	{"fn() { }()", "null"},
+	{"map([1], fn(x) { while (false) { } })[0]", "null"},
+	{"for (x in 5) { }", "Error: 1:11: cannot iterate over INTEGER"},
+	{"while (1 + true) { }", "Error: 1:10: type mismatch: INTEGER + BOOLEAN"},
+	{"for (x in [1]) { x + true; }", "Error: 1:20: type mismatch: INTEGER + BOOLEAN"},
+}
+
+var TryCatch = []Case{
+	{"try { 1 } catch (e) { 2 }", "1"},
+	{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+	{`try { 1 / 0 } catch (e) { e["position"] }`, "1:9"},
+	{`try { 1 / 0 } catch (e) { e["stack"] }`, "[]"},
+	{`try { throw("bad") } catch (e) { e["message"] }`, "bad"},
+	{`try { throw(42) } catch (e) { e["value"] }`, "42"},
+	{`try { throw("x") } catch { 7 }`, "7"},
+	{`let f = fn() { throw("x") }; try { f() } catch (e) { e["stack"] }`, "[f (1:37)]"},
+	// 尾调用发起者的栈帧也留在调用栈中
+	{`let f = fn() { throw("x") }; let g = fn() { f() }; try { g() } catch (e) { e["stack"] }`, "[f (1:46), g (1:59)]"},
+	{`let f = fn(n) { if (n == 0) { throw("x") } else { f(n - 1) } }; try { f(2) } catch (e) { e["stack"] }`, "[f (1:52), f (1:52), f (1:72)]"},
+	{`let f = fn() { try { 1 / 0 } catch (e) { e["stack"] } }; f()`, "[f (1:59)]"},
+	{`let f = fn() { try { 1 / 0 } catch (e) { e["position"] } }; f()`, "1:24"},
+	{`try { nope } catch (e) { e["message"] }`, "identifier not found: nope"},
+	{`try { nope = 1 } catch (e) { e["position"] }`, "1:7"},
+	{`let log = []; let r = try { log = push(log, 1); throw("x") } catch (e) { log = push(log, 2); 5 } finally { log = push(log, 3) }; push(log, r)`,
+		"[1, 2, 3, 5]"},
+	{`let n = 0; try { try { throw("x") } finally { n = 1 } } catch (e) { n + 10 }`, "11"},
+	{`try { try { throw("a") } catch (e) { throw(e["message"] + "b") } } catch (e) { e["message"] }`, "ab"},
+	{`let n = 0; let f = fn() { try { return 1 } finally { n += 1 } }; f() + f() + n`, "4"},
+	{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, "2"},
+	{`let n = 0; for (i in [1, 2, 3]) { try { if (i == 2) { break } } finally { n += 1 } }; n`, "2"},
+	{`let n = 0; for (i in [1, 2, 3]) { try { continue } catch (e) { } finally { n += i } }; n`, "6"},
+	{`let f = fn() { throw("x") }; let g = fn() { try { return f() } catch (e) { "caught" } }; g()`, "caught"},
+	{`let g = fn(x) { x / 0 }; let f = fn() { g(1) }; let r = try { f() } catch (e) { 1 }; r + len([1, 2])`, "3"},
+	{`let f = fn(x) { if (x < 0) { throw("negative") } x }; let s = 0; for (x in [1, -2, 3]) { s += try { f(x) } catch (e) { 0 } }; s`, "4"},
+	{`try { throw("x") } finally { 1 }`, "Error: 1:12: x"},
+	{`try { throw("x") } catch (e) { throw("y") } finally { 1 }`, "Error: 1:37: y"},
+	{`try { 1 } finally { 1 / 0 }`, "Error: 1:23: division by zero"},
+}
+
+// 闭包和外层函数共享被捕获的变量，赋值对双方都可见
+var AssignCapturedVariables = []Case{
+	{`let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()`, "3"},
+	{`let counter = fn() { let n = 0; fn() { n += 1; n } }; let a = counter(); let b = counter(); a(); a(); b()`, "1"},
+	{`let f = fn() { let x = 1; let g = fn() { x }; x = 2; g() }; f()`, "2"},
+	{`let f = fn(x) { let inc = fn() { x += 10 }; inc(); x }; f(1)`, "11"},
+	{`let f = fn() { let x = 0; let g = fn() { fn() { x += 1 } }; let h = g(); h(); h(); x }; f()`, "2"},
+	{`let f = fn() { let fs = []; for (i in [1, 2, 3]) { fs = push(fs, fn() { i }) }; fs[0]() }; f()`, "3"},
+	{`let f = fn() { let fs = []; let i = 0; while (i < 3) { let j = i; fs = push(fs, fn() { j }); i += 1 }; fs[0]() }; f()`, "2"},
+	{`let f = fn() { let x = 1; let g = fn() { x }; let x = 5; g() }; f()`, "5"},
+	{`let f = fn() { let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; if (isEven(10)) { 1 } else { 0 } }; f()`, "1"},
+	{`let f = fn() { let g = fn() { g = 7; 1 }; g() + g }; f()`, "8"},
+	{`let f = fn() { f = 1; 2 }; f()`, "2"},
+	{`let f = fn() { f = 1; 2 }; f() + f`, "3"},
+	{`let f = fn() { f = fn() { 5 }; 2 }; f() + f()`, "7"},
+}
+
+// 函数可以引用在它之后才定义的全局变量，执行到定义之前使用时报告变量没有定义
+var GlobalForwardReferences = []Case{
+	{"let f = fn() { z }; let z = 3; f()", "3"},
+	{"let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(10)", "true"},
+	{"let f = fn() { x }; for (x in [1, 2]) { }; f()", "2"},
+	{"let f = fn() { z }; f(); let z = 3;", "Error: 1:16: identifier not found: z"},
+	{"let f = fn() { z = 1 }; f(); let z = 3;", "Error: 1:16: identifier not found: z"},
+	{"z = 1; let z = 2;", "Error: 1:1: identifier not found: z"},
+	{"z += 1; let z = 2;", "Error: 1:1: identifier not found: z"},
+	{"if (false) { let z = 1 }; z", "Error: 1:27: identifier not found: z"},
+	{"let a = len([1, 2]); let len = 5; a + len", "7"},
+}
+
+var HashOrder = []Case{
+	{`{"b": 1, "a": 2, 3: 3}`, `{b: 1, a: 2, 3: 3}`},
+	{`let h = {"z": 1}; h["a"] = 2; h["z"] = 3; h`, `{z: 3, a: 2}`},
+	{`let s = ""; for (k in {"c": 1, "a": 2, "b": 3}) { s += k; } s`, "cab"},
+	{`let h = {}; for (x in [5, 3, 9, 1]) { h[x] = true; } h`, `{5: true, 3: true, 9: true, 1: true}`},
+}
+
+var CompositeHashKeys = []Case{
+	{`let h = {[1, 2]: "a"}; h[[1, 2]]`, "a"},
+	{`let g = {}; for (r in [["eu", 2020], ["us", 2021], ["eu", 2020]]) { if (g[r]) { g[r] += 1 } else { g[r] = 1 } }; g[["eu", 2020]]`, "2"},
+	{`let k = [1]; let h = {}; h[k] = 1; k[0] = 2; h[[1]]`, "1"},
+	{`{{"a": 1, "b": [2]}: 1}[{"b": [2], "a": 1}]`, "1"},
+	{`let h = {}; h[[][0]] = 5; h[[][0]]`, "5"},
+	{`for (k in {[1]: 2}) { k[0] = 5 }`, "Error: 1:24: cannot modify ARRAY used as hash key"},
+	{`{[fn(x) { x }]: 1}`, "Error: 1:2: unusable as hash key: ARRAY"},
+	{`let a = [1]; a[0] = a; {a: 1}`, "Error: 1:25: unusable as hash key: ARRAY"},
+}
+
+var HashBuiltins = []Case{
+	{`keys({"b": 1, "a": 2})`, `[b, a]`},
+	{`values({"b": 1, "a": 2})`, `[1, 2]`},
+	{`entries({"b": 1, [1]: 2})`, `[[b, 1], [[1], 2]]`},
+	{`keys({})`, `[]`},
+	{`has({"a": 1}, "a")`, `true`},
+	{`has({"a": 1}, "b")`, `false`},
+	{`if (has({"a": 1}, "b")) { 1 } else { 2 }`, `2`},
+	{`let h = {"a": 1}; let g = put(h, "b", 2); [h, g]`, `[{a: 1}, {a: 1, b: 2}]`},
+	{`put({"a": 1, "b": 2}, "a", 3)`, `{a: 3, b: 2}`},
+	{`let h = {"a": 1, "b": 2, "c": 3}; let g = delete(h, "b"); [h, g]`, `[{a: 1, b: 2, c: 3}, {a: 1, c: 3}]`},
+	{`delete({"a": 1}, "z")`, `{a: 1}`},
+	{`merge({"a": 1, "b": 2}, {"c": 3, "a": 4})`, `{a: 4, b: 2, c: 3}`},
+	{`keys([])`, "Error: 1:5: argument to `keys` must be HASH, got ARRAY"},
+	{`values({}, {})`, "Error: 1:7: wrong number of arguments. got=2, want=1"},
+	{`has({}, puts)`, "Error: 1:4: unusable as hash key: BUILTIN"},
+	{`put({}, 1)`, "Error: 1:4: wrong number of arguments. got=2, want=3"},
+	{`delete(1, 1)`, "Error: 1:7: argument to `delete` must be HASH, got INTEGER"},
+	{`merge({}, [])`, "Error: 1:6: argument to `merge` must be HASH, got ARRAY"},
+}
+
+var CollectionBuiltins = []Case{
+	{`map([1, 2, 3], fn(x) { x * 2 })`, `[2, 4, 6]`},
+	{`map([], fn(x) { x })`, `[]`},
+	{`map([1, 2], len)`, "Error: 1:4: argument to `len` not supported, got INTEGER"},
+	{`map([[1], [2, 3]], fn(a) { map(a, fn(x) { x + 1 }) })`, `[[2], [3, 4]]`},
+	{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, `[2, 4]`},
+	{`filter([1, if (false) { 1 }, false, 0], fn(x) { x })`, `[1, 0]`},
+	{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 0)`, `10`},
+	{`reduce([], fn(acc, x) { acc + x }, "init")`, `init`},
+	{`reduce([1], fn(acc, x) { acc })`, "Error: 1:7: wrong number of arguments. got=2, want=3"},
+	{`let a = [3, 1, 2]; [sort(a), a]`, `[[1, 2, 3], [3, 1, 2]]`},
+	{`sort(["b", "c", "a"])`, `[a, b, c]`},
+	{`sort([2.5, 1, 2])`, `[1, 2, 2.5]`},
+	{`sort([3, 1, 2], fn(a, b) { a > b })`, `[3, 2, 1]`},
+	{`sort([[2, "a"], [1, "b"], [2, "c"], [1, "d"]], fn(a, b) { a[0] < b[0] })`, `[[1, b], [1, d], [2, a], [2, c]]`},
+	{`sort([1, "a"])`, "Error: 1:5: cannot compare STRING with INTEGER"},
+	{`any([1, 2, 3], fn(x) { x > 2 })`, `true`},
+	{`any([], fn(x) { true })`, `false`},
+	{`any([1, 2], fn(x) { if (x == 1) { true } else { throw("unreachable") } })`, `true`},
+	{`all([1, 2, 3], fn(x) { x > 0 })`, `true`},
+	{`all([1, 2, 3], fn(x) { x < 2 })`, `false`},
+	{`all([], fn(x) { false })`, `true`},
+	{`zip([1, 2, 3], ["a", "b"])`, `[[1, a], [2, b]]`},
+	{`range(4)`, `[0, 1, 2, 3]`},
+	{`range(2, 5)`, `[2, 3, 4]`},
+	{`range(5, 0, -2)`, `[5, 3, 1]`},
+	{`range(3, 1)`, `[]`},
+	{`range(0, 3, 0)`, "Error: 1:6: `range` step must not be zero"},
+	{`range("3")`, "Error: 1:6: argument to `range` must be INTEGER, got STRING"},
+	{`flatten([1, [2, 3], [[4]], []])`, `[1, 2, 3, [4]]`},
+	{`map(1, fn(x) { x })`, "Error: 1:4: argument to `map` must be ARRAY, got INTEGER"},
+	{`map([1], 1)`, "Error: 1:4: not a function: INTEGER"},
+	{`map([1, 2], fn(x) { if (x == 2) { throw("bad element") } x })`, "Error: 1:40: bad element"},
+	{`try { map([1, 2], fn(x) { throw({"code": x}) }) } catch (e) { e["value"] }`, `{code: 1}`},
+	{`map([1, 2], fn(x) { try { throw(x) } catch (e) { e["message"] } })`, `[1, 2]`},
+	{`let count = 0; try { filter([1, 2, 3], fn(x) { count += 1; if (x == 2) { throw("stop") } true }) } catch { count }`, `2`},
+}
+
+// 数组是持久化的：push、rest 和 set 返回新的数组，下标赋值只修改这一个数组
+var ArrayValueSemantics = []Case{
+	{`let a = [1, 2, 3]; let b = push(a, 4); let c = push(a, 5); [a, b, c]`, `[[1, 2, 3], [1, 2, 3, 4], [1, 2, 3, 5]]`},
+	{`let a = [1, 2, 3]; let b = rest(a); a[1] = 9; [a, b]`, `[[1, 9, 3], [2, 3]]`},
+	{`let a = [1, 2, 3]; let b = rest(a); b[0] = 9; [a, b]`, `[[1, 2, 3], [9, 3]]`},
+	{`let a = [1, 2, 3]; let b = set(a, 0, 9); [a, b]`, `[[1, 2, 3], [9, 2, 3]]`},
+	{`let a = [1, 2]; let b = a; b[0] = 9; a`, `[9, 2]`},
+	{`let a = [1]; a[0] = a; a`, `[[...]]`},
+	{`let h = {}; h["h"] = h; h["a"] = [h]; h`, `{h: {...}, a: [{...}]}`},
+	{`rest(rest([1, 2]))`, `[]`},
+	{`let s = 0; for (x in rest(range(40))) { s += x }; s`, `780`},
+	{`let a = []; let i = 0; while (i < 1100) { a = push(a, i); i += 1 }; let b = rest(rest(a)); [len(b), b[0], b[1097], a[1099]]`, `[1098, 2, 1099, 1099]`},
+	{`let a = range(100); let b = a; let i = 0; while (i < 100) { b = set(b, i, i * 2); i += 1 }; [a[99], b[99], len(b)]`, `[99, 198, 100]`},
+	{`set([1], 1, 0)`, "Error: 1:4: index out of range: 1"},
+	{`set([1], "0", 0)`, "Error: 1:4: index to `set` must be INTEGER, got STRING"},
+	{`set({}, 0, 0)`, "Error: 1:4: argument to `set` must be ARRAY, got HASH"},
+}
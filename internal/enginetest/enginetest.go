@@ -0,0 +1,32 @@
+// Package enginetest 保存求值器和虚拟机共用的测试用例
+// 两个引擎对同样的程序应该得到同样的结果，用例只写一份，两边的测试不会各自修改而不一致
+package enginetest
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+// 期望的结果是值的 Inspect()，出错时是带位置的错误，例如 "Error: 1:3: division by zero"
+type Case struct {
+	Input    string
+	Expected string
+}
+
+// 用某个引擎执行一段程序，返回最后一个表达式的值，出错时返回错误对象
+type RunFunc func(t *testing.T, input string) object.Object
+
+func Run(t *testing.T, tests []Case, run RunFunc) {
+	t.Helper()
+
+	for _, tt := range tests {
+		result := run(t, tt.Input)
+		if result == nil {
+			t.Errorf("%q: got no result, want=%s", tt.Input, tt.Expected)
+			continue
+		}
+		if result.Inspect() != tt.Expected {
+			t.Errorf("%q: got=%s, want=%s", tt.Input, result.Inspect(), tt.Expected)
+		}
+	}
+}
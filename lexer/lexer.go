@@ -1,24 +1,52 @@
 package lexer
 
 import (
+	"fmt"
 	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// 只能读取ASCLL码，
-// TODO：utf-8,emoji
-// TODO：input的类型，以及记录行号等问题
+// 按 utf-8 解码，一次读取一个 rune，标识符可以包含 unicode 字母
 
 
 type Lexer struct {
+	filename string	// 源文件名，仅用于错误信息中的位置
 	input string 	// 输入的需要进行词法分析的
 	position int	// 当前字符的位置
 	readPosition int	// 当前位置的下一个位置
-	ch byte		// 当前字符
+	ch rune		// 当前字符
+	line int	// 当前字符所在的行
+	column int	// 当前字符所在的列
+	errors []*Error	// 词法错误
+	mode Mode	// 控制词法分析的行为
 }
 
+// 词法分析器的模式
+type Mode uint
+
+const (
+	// 把注释作为 COMMENT 词法单元返回，而不是跳过，供格式化、文档工具使用
+	ScanComments Mode = 1 << iota
+)
+
 func New(input string) *Lexer {
+	return NewFile("", input)
+}
+
+// 设置词法分析器的模式，需要在读取第一个词法单元之前调用
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
+// 同 New，但是词法单元的位置中会带上文件名
+func NewFile(filename string, input string) *Lexer {
 	l := &Lexer{
+		filename: filename,
 		input: input,
+		line: 1,
 	}
 	// 在创建对象的时候就读取一起char
 	l.readChar()
@@ -33,41 +61,85 @@ func New(input string) *Lexer {
 func (l *Lexer) NextToken() token.Token {
 	var t *token.Token
 	l.skipWhitespace()
+	// 注释：// 到行尾，/* 到 */
+	for l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+		pos := l.currentPos()
+		comment := l.readComment()
+		if l.mode&ScanComments != 0 {
+			return token.Token{Type: token.COMMENT, Literal: comment, Pos: pos}
+		}
+		l.skipWhitespace()
+	}
+	pos := l.currentPos()
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			t = &token.Token{
-				Literal: string(ch) + string(l.ch),
-				Type: token.EQ,
-			}
+			t = l.readTwoCharToken(token.EQ)
 		} else {
 			t = token.NewToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		t = token.NewToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			t = l.readTwoCharToken(token.PLUS_ASSIGN)
+		} else {
+			t = token.NewToken(token.PLUS, l.ch)
+		}
 	case '-':
-		t = token.NewToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			t = l.readTwoCharToken(token.MINUS_ASSIGN)
+		} else {
+			t = token.NewToken(token.MINUS, l.ch)
+		}
 	case '*':
-		t = token.NewToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			t = l.readTwoCharToken(token.ASTERISK_ASSIGN)
+		} else {
+			t = token.NewToken(token.ASTERISK, l.ch)
+		}
 	case '/':
-		t = token.NewToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			t = l.readTwoCharToken(token.SLASH_ASSIGN)
+		} else {
+			t = token.NewToken(token.SLASH, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
-			ch := l.ch
-			l.readChar()
-			t = &token.Token{
-				Literal: string(ch) + string(l.ch),
-				Type: token.NOT_EQ,
-			}
+			t = l.readTwoCharToken(token.NOT_EQ)
 		} else {
 			t = token.NewToken(token.BANG, l.ch)
 		}
+	case '%':
+		if l.peekChar() == '=' {
+			t = l.readTwoCharToken(token.PERCENT_ASSIGN)
+		} else {
+			t = token.NewToken(token.PERCENT, l.ch)
+		}
 	case '<':
-		t = token.NewToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			t = l.readTwoCharToken(token.LT_EQ)
+		} else {
+			t = token.NewToken(token.LT, l.ch)
+		}
 	case '>':
-		t = token.NewToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			t = l.readTwoCharToken(token.GT_EQ)
+		} else {
+			t = token.NewToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			t = l.readTwoCharToken(token.AND)
+		} else {
+			l.error(pos, "illegal character %q", l.ch)
+			t = token.NewToken(token.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			t = l.readTwoCharToken(token.OR)
+		} else {
+			l.error(pos, "illegal character %q", l.ch)
+			t = token.NewToken(token.ILLEGAL, l.ch)
+		}
 	case '(':
 		t = token.NewToken(token.LPAREN, l.ch)
 	case ')':
@@ -89,7 +161,19 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		t = &token.Token{}
 		t.Type = token.STRING
-		t.Literal = l.readString()
+		literal, ok := l.readString()
+		if !ok {
+			t.Type = token.ILLEGAL
+		}
+		t.Literal = literal
+	case '`':
+		t = &token.Token{}
+		t.Type = token.STRING
+		literal, ok := l.readRawString()
+		if !ok {
+			t.Type = token.ILLEGAL
+		}
+		t.Literal = literal
 	case 0:
 		//t.Literal = " "
 		//t.Type = token.EOF
@@ -104,40 +188,97 @@ func (l *Lexer) NextToken() token.Token {
 				//Type: token.LookupIdent(t.Literal),
 			}
 			t.Type = token.LookupIdent(t.Literal)
+			t.Pos = pos
 			return *t
 		} else if isNumber(l.ch) {
+			literal, tokenType := l.readNumber()
 			t = &token.Token{
-				Type: token.INT,
-				Literal: l.readNumber(),
+				Type: tokenType,
+				Literal: literal,
+				Pos: pos,
 			}
 			return *t
 		} else {
+			l.error(pos, "illegal character %q", l.ch)
 			t = token.NewToken(token.ILLEGAL, l.ch)
 		}
 	}
 	l.readChar()
+	t.Pos = pos
 	return *t
 }
 
 
+// 读取 <= && 这种由两个字符组成的词法单元，结束时 l.ch 停在第二个字符上
+func (l *Lexer) readTwoCharToken(t token.TokenType) *token.Token {
+	ch := l.ch
+	l.readChar()
+	return &token.Token{
+		Literal: string(ch) + string(l.ch),
+		Type: t,
+	}
+}
+
+// 词法错误
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// 词法分析过程中遇到的错误
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+func (l *Lexer) error(pos token.Position, format string, args ...interface{}) {
+	l.errors = append(l.errors, &Error{
+		Pos: pos,
+		Msg: fmt.Sprintf(format, args...),
+	})
+}
+
+// 当前字符的位置
+func (l *Lexer) currentPos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset: l.position,
+		Line: l.line,
+		Column: l.column,
+	}
+}
+
+
 // 一个个的去读取input中的字符，把字符写入ch字段中
 func (l *Lexer) readChar() {
+	// 换行之后行号加一，列号重新计数
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 1
+	} else {
+		l.column += 1
+	}
+	width := 0
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
 
 // 窥探下一个字符，来判断是否是 == ！= 这种；
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} 
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 
@@ -153,28 +294,169 @@ func (l *Lexer) readIdentifier() string {
 
 
 // 读取数字，同上方函数相似，把数字转换为token
-func (l *Lexer) readNumber() string {
+// 带小数点或者指数部分的是浮点数，例如 3.14、1e-9、2.5E3
+func (l *Lexer) readNumber() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+	// 小数点后面必须跟数字
+	if l.ch == '.' && isNumber(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		if l.isExponentStart() {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isNumber(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-// 读string
-func (l *Lexer) readString() string {
+// 当前字符是 e/E 时，判断后面是否是合法的指数部分（可选的正负号加数字）
+func (l *Lexer) isExponentStart() bool {
+	next := l.peekChar()
+	if isNumber(next) {
+		return true
+	}
+	if (next == '+' || next == '-') && l.readPosition+1 < len(l.input) {
+		return isNumber(rune(l.input[l.readPosition+1]))
+	}
+	return false
+}
+
+// 读string，处理 \n \t \r \" \\ 和 \u{...} 转义
+// 结束时 l.ch 停在右引号上；没有右引号时返回 false
+func (l *Lexer) readString() (string, bool) {
+	start := l.currentPos()
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			if l.atEOF() {
+				l.error(start, "unterminated string literal")
+				return out.String(), false
+			}
+			out.WriteRune(l.ch)
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// 读取反斜杠后面的转义字符，写入 out
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.currentPos()
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '"':
+		out.WriteByte('"')
+	case '\\':
+		out.WriteByte('\\')
+	case 'u':
+		if l.peekChar() != '{' {
+			l.error(pos, "invalid unicode escape, expected \\u{...}")
+			return
+		}
+		l.readChar()
+		begin := l.readPosition
+		for l.peekChar() != '}' && l.peekChar() != '"' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		digits := l.input[begin:l.readPosition]
+		if l.peekChar() != '}' {
+			l.error(pos, "invalid unicode escape \\u{%s", digits)
+			return
+		}
+		l.readChar()
+		code, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || code > utf8.MaxRune || 0xD800 <= code && code <= 0xDFFF {
+			l.error(pos, "invalid unicode escape \\u{%s}", digits)
+			return
+		}
+		out.WriteRune(rune(code))
+	default:
+		if l.atEOF() {
+			// 由 readString 报告字符串没有结束
+			return
+		}
+		l.error(pos, "unknown escape sequence \\%c", l.ch)
+		out.WriteRune(l.ch)
+	}
+}
+
+// 读取反引号括起来的原始字符串，不处理转义，可以跨行
+func (l *Lexer) readRawString() (string, bool) {
+	start := l.currentPos()
 	position := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
-		} 
+		if l.ch == '`' {
+			return l.input[position:l.position], true
+		}
+		if l.atEOF() {
+			l.error(start, "unterminated raw string literal")
+			return l.input[position:l.position], false
+		}
 	}
-	return l.input[position:l.position]
 }
 
 
 
+// 读取一条注释，返回包括 // 或者 /* */ 在内的完整文本
+// 行注释不包含结尾的换行符；块注释没有结束时报告错误
+func (l *Lexer) readComment() string {
+	start := l.currentPos()
+	position := l.position
+	l.readChar()
+	if l.ch == '/' {
+		for l.ch != '\n' && !l.atEOF() {
+			l.readChar()
+		}
+		return strings.TrimSuffix(l.input[position:l.position], "\r")
+	}
+	l.readChar()
+	for {
+		if l.atEOF() {
+			l.error(start, "unterminated block comment")
+			return l.input[position:l.position]
+		}
+		if l.ch == '*' && l.peekChar() == '/' {
+			l.readChar()
+			l.readChar()
+			return l.input[position:l.position]
+		}
+		l.readChar()
+	}
+}
+
+// 是否已经读完了全部输入
+func (l *Lexer) atEOF() bool {
+	return l.ch == 0 && l.position >= len(l.input)
+}
+
 // 当读取到的是空格时，跳过
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' { 
@@ -183,12 +465,13 @@ func (l *Lexer) skipWhitespace() {
 }
 
 
-// 一个工具方法，判断byte是否为字母
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// 一个工具方法，判断rune是否为字母，包括中文等 unicode 字母
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-// 工具方法，判断byte是否为数字
-func isNumber(ch byte) bool {
+// 工具方法，判断rune是否为数字
+func isNumber(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
\ No newline at end of file
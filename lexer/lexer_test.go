@@ -16,7 +16,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -31,6 +31,11 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+a <= b >= c % d && e || f;
+macro(x, y) { x + y; };
+a += 1; b -= 2; c *= 3; d /= 4; e %= 5;
+while for in break continue
+try catch finally
 `
 
 
@@ -124,6 +129,189 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.IDENT, "a"},
+		{token.LT_EQ, "<="},
+		{token.IDENT, "b"},
+		{token.GT_EQ, ">="},
+		{token.IDENT, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "d"},
+		{token.AND, "&&"},
+		{token.IDENT, "e"},
+		{token.OR, "||"},
+		{token.IDENT, "f"},
+		{token.SEMICOLON, ";"},
+		{token.MACRO, "macro"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COMMA, ","},
+		{token.IDENT, "y"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.RBRACE, "}"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "b"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "c"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "d"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "e"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.FINALLY, "finally"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";
+`
+	tests := []struct {
+		expectedType   token.TokenType
+		expectedLine   int
+		expectedColumn int
+		expectedOffset int
+	}{
+		{token.LET, 1, 1, 0},
+		{token.IDENT, 1, 5, 4},
+		{token.ASSIGN, 1, 7, 6},
+		{token.INT, 1, 9, 8},
+		{token.SEMICOLON, 1, 10, 9},
+		{token.IDENT, 2, 3, 13},
+		{token.PLUS, 2, 5, 15},
+		{token.STRING, 2, 7, 17},
+		{token.SEMICOLON, 2, 11, 21},
+		{token.EOF, 3, 1, 23},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.Offset != tt.expectedOffset {
+			t.Fatalf("tests[%d] - offset wrong. expected=%d, got=%d",
+				i, tt.expectedOffset, tok.Pos.Offset)
+		}
+		if tok.Pos.Filename != "test.mk" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, tok.Pos.Filename)
+		}
+	}
+}
+
+
+func TestUnicode(t *testing.T) {
+	input := `let 名字 = "你好，世界";
+名字 + "😀";
+café`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "名字", 5},
+		{token.ASSIGN, "=", 8},
+		{token.STRING, "你好，世界", 10},
+		{token.SEMICOLON, ";", 17},
+		{token.IDENT, "名字", 1},
+		{token.PLUS, "+", 4},
+		{token.STRING, "😀", 6},
+		{token.SEMICOLON, ";", 9},
+		{token.IDENT, "café", 1},
+		{token.EOF, "", 5},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 1e-9 2.5E3 10e 1.x 7e+2 [1].x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2.5E3"},
+		{token.INT, "10"},
+		{token.IDENT, "e"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.FLOAT, "7e+2"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
 		{token.EOF, ""},
 	}
 
@@ -131,15 +319,137 @@ if (5 < 10) {
 
 	for i, tt := range tests {
 		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
 
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"a\nb"`, token.STRING, "a\nb"},
+		{`"a\tb\r"`, token.STRING, "a\tb\r"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u{4F60}\u{597D}\u{1F600}"`, token.STRING, "你好😀"},
+		{"`raw\\n\nline`", token.STRING, "raw\\n\nline"},
+		{"``", token.STRING, ""},
+		{`"never ends`, token.ILLEGAL, "never ends"},
+		{"`never ends", token.ILLEGAL, "never ends"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
 		if tok.Type != tt.expectedType {
 			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
 				i, tt.expectedType, tok.Type)
 		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tt.expectedType == token.STRING && len(l.Errors()) != 0 {
+			t.Fatalf("tests[%d] - unexpected errors: %v", i, l.Errors())
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let s = "abc`, "1:9: unterminated string literal"},
+		{"let s = `abc\n", "1:9: unterminated raw string literal"},
+		{`"a\qb"`, `1:3: unknown escape sequence \q`},
+		{`"\u{110000}"`, `1:2: invalid unicode escape \u{110000}`},
+		{`"\u41"`, `1:2: invalid unicode escape, expected \u{...}`},
+		{`"\`, "1:1: unterminated string literal"},
+		{"\n  @", "2:3: illegal character '@'"},
+		{"1 /* never closed", "1:3: unterminated block comment"},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		errors := l.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("tests[%d] - expected 1 error, got=%v", i, errors)
+		}
+		if errors[0].Error() != tt.expected {
+			t.Errorf("tests[%d] - wrong error. expected=%q, got=%q", i, tt.expected, errors[0].Error())
+		}
+	}
+}
+
 
+func TestComments(t *testing.T) {
+	input := `// 开头的注释
+let x = 5; // 行尾注释
+/* 块注释
+   可以跨行 */ x / 2;
+/**/`
+
+	skipped := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH, token.INT, token.SEMICOLON, token.EOF,
+	}
+	l := New(input)
+	for i, expected := range skipped {
+		tok := l.NextToken()
+		if tok.Type != expected {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, expected, tok.Type)
+		}
+	}
+
+	kept := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{token.COMMENT, "// 开头的注释", 1},
+		{token.LET, "let", 2},
+		{token.IDENT, "x", 2},
+		{token.ASSIGN, "=", 2},
+		{token.INT, "5", 2},
+		{token.SEMICOLON, ";", 2},
+		{token.COMMENT, "// 行尾注释", 2},
+		{token.COMMENT, "/* 块注释\n   可以跨行 */", 3},
+		{token.IDENT, "x", 4},
+		{token.SLASH, "/", 4},
+		{token.INT, "2", 4},
+		{token.SEMICOLON, ";", 4},
+		{token.COMMENT, "/**/", 5},
+		{token.EOF, "", 5},
+	}
+	l = New(input)
+	l.SetMode(ScanComments)
+	for i, tt := range kept {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
 		if tok.Literal != tt.expectedLiteral {
 			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
 				i, tt.expectedLiteral, tok.Literal)
 		}
+		if tok.Pos.Line != tt.expectedLine {
+			t.Fatalf("tests[%d] - line wrong. expected=%d, got=%d",
+				i, tt.expectedLine, tok.Pos.Line)
+		}
 	}
-}
\ No newline at end of file
+}
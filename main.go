@@ -1,19 +1,50 @@
 package main
 
 import ( 
+	"flag" 
 	"fmt" 
 	"os" 
 	"os/user" 
+	"monkey/evaluator" 
+	"monkey/object" 
 	"monkey/repl" 
 ) 
 
 
 func main() { 
+	engine := flag.String("engine", repl.ENGINE_EVAL, "execution engine: eval or vm")
+	maxDepth := flag.Int("max-depth", evaluator.MaxCallDepth, "maximum call depth of the eval engine")
+	overflow := flag.String("overflow", "wrap", "integer overflow handling: wrap, error or promote")
+	flag.Parse()
+	evaluator.MaxCallDepth = *maxDepth
+	if *engine != repl.ENGINE_EVAL && *engine != repl.ENGINE_VM {
+		fmt.Fprintf(os.Stderr, "unknown engine: %s\n", *engine)
+		os.Exit(2)
+	}
+	switch *overflow {
+	case "wrap":
+		object.Overflow = object.OverflowWrap
+	case "error":
+		object.Overflow = object.OverflowError
+	case "promote":
+		object.Overflow = object.OverflowPromote
+	default:
+		fmt.Fprintf(os.Stderr, "unknown overflow mode: %s\n", *overflow)
+		os.Exit(2)
+	}
+
+	// monkey script.mk 直接执行脚本文件
+	if flag.NArg() > 0 {
+		if !repl.RunFile(flag.Arg(0), os.Stderr, *engine) {
+			os.Exit(1)
+		}
+		return
+	}
 	user, err := user.Current() 
 	if err != nil { 
 		panic(err) 
 	} 
 	fmt.Printf("Hello %s! This is the Monkey programming language!\n", user.Username) 
 	fmt.Printf("Feel free to type in commands\n") 
-	repl.Start(os.Stdin, os.Stdout) 
-}
\ No newline at end of file
+	repl.Start(os.Stdin, os.Stdout, *engine) 
+}
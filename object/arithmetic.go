@@ -0,0 +1,159 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+// 整数运算溢出时的处理方式
+type OverflowMode int
+
+const (
+	OverflowWrap    OverflowMode = iota // 和 Go 一样回绕，默认的方式
+	OverflowError                       // 返回错误
+	OverflowPromote                     // 转换为 BigInt 继续计算
+)
+
+// 求值器和虚拟机共用的溢出处理方式
+var Overflow = OverflowWrap
+
+// 是否是整数：INTEGER 或者 BIGINT
+func IsInteger(obj Object) bool {
+	t := obj.Type()
+	return t == INTEGER_OBJ || t == BIGINT_OBJ
+}
+
+// 整数之间的 + - * / %，两边都需要是整数
+// 除数为 0 时返回错误，溢出时按照 Overflow 处理
+func IntegerArithmetic(operator string, left, right Object) Object {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if !lok || !rok {
+		return bigIntArithmetic(operator, toBigInt(left), toBigInt(right))
+	}
+
+	a, b := l.Value, r.Value
+	if (operator == "/" || operator == "%") && b == 0 {
+		return newError("division by zero")
+	}
+
+	var result int64
+	var overflow bool
+	switch operator {
+	case "+":
+		result = a + b
+		overflow = (a^result)&(b^result) < 0
+	case "-":
+		result = a - b
+		overflow = (a^b)&(a^result) < 0
+	case "*":
+		result = a * b
+		overflow = a != 0 && (result/a != b || (a == -1 && b == math.MinInt64))
+	case "/":
+		result = a / b
+		overflow = a == math.MinInt64 && b == -1
+	case "%":
+		result = a % b
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	if !overflow || Overflow == OverflowWrap {
+		return &Integer{Value: result}
+	}
+	if Overflow == OverflowError {
+		return newError("integer overflow: %d %s %d", a, operator, b)
+	}
+	return bigIntArithmetic(operator, big.NewInt(a), big.NewInt(b))
+}
+
+// 整数取负，-9223372036854775808 会溢出
+func NegateInteger(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Integer:
+		if obj.Value != math.MinInt64 || Overflow == OverflowWrap {
+			return &Integer{Value: -obj.Value}
+		}
+		if Overflow == OverflowError {
+			return newError("integer overflow: -(%d)", obj.Value)
+		}
+		return normalizeBigInt(new(big.Int).Neg(big.NewInt(obj.Value)))
+	case *BigInt:
+		return normalizeBigInt(new(big.Int).Neg(obj.Value))
+	default:
+		return newError("unknown operator: -%s", obj.Type())
+	}
+}
+
+// 比较两个整数，返回 -1、0 或 1
+func CompareIntegers(left, right Object) int {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		switch {
+		case l.Value < r.Value:
+			return -1
+		case l.Value > r.Value:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return toBigInt(left).Cmp(toBigInt(right))
+}
+
+// 整数转换为 float64，超出范围的 BigInt 转换为 ±Inf
+func IntegerToFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	}
+	return 0
+}
+
+// 和 int64 的 / % 一样向 0 取整，所以用 Quo、Rem 而不是 Div、Mod
+func bigIntArithmetic(operator string, a, b *big.Int) Object {
+	result := new(big.Int)
+	switch operator {
+	case "+":
+		result.Add(a, b)
+	case "-":
+		result.Sub(a, b)
+	case "*":
+		result.Mul(a, b)
+	case "/":
+		if b.Sign() == 0 {
+			return newError("division by zero")
+		}
+		result.Quo(a, b)
+	case "%":
+		if b.Sign() == 0 {
+			return newError("division by zero")
+		}
+		result.Rem(a, b)
+	default:
+		return newError("unknown operator: %s %s %s", BIGINT_OBJ, operator, BIGINT_OBJ)
+	}
+	return normalizeBigInt(result)
+}
+
+func toBigInt(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInt:
+		return obj.Value
+	}
+	return new(big.Int)
+}
+
+// 能用 int64 表示的结果转换回 Integer
+func normalizeBigInt(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
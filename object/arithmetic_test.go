@@ -0,0 +1,64 @@
+package object
+
+import "testing"
+
+func TestIntegerArithmetic(t *testing.T) {
+	defer func(mode OverflowMode) { Overflow = mode }(Overflow)
+
+	maxInt := &Integer{Value: 9223372036854775807}
+	minInt := &Integer{Value: -9223372036854775808}
+	tests := []struct {
+		mode     OverflowMode
+		operator string
+		left     Object
+		right    Object
+		expected string
+	}{
+		{OverflowWrap, "+", maxInt, &Integer{Value: 1}, "-9223372036854775808"},
+		{OverflowWrap, "/", minInt, &Integer{Value: -1}, "-9223372036854775808"},
+		{OverflowWrap, "%", &Integer{Value: 7}, &Integer{Value: 0}, "Error: division by zero"},
+		{OverflowError, "-", minInt, &Integer{Value: 1}, "Error: integer overflow: -9223372036854775808 - 1"},
+		{OverflowError, "*", minInt, &Integer{Value: -1}, "Error: integer overflow: -9223372036854775808 * -1"},
+		{OverflowError, "/", minInt, &Integer{Value: -1}, "Error: integer overflow: -9223372036854775808 / -1"},
+		{OverflowError, "*", &Integer{Value: 3037000499}, &Integer{Value: 3037000499}, "9223372030926249001"},
+		{OverflowPromote, "*", minInt, &Integer{Value: -1}, "9223372036854775808"},
+		{OverflowPromote, "/", minInt, &Integer{Value: -1}, "9223372036854775808"},
+		{OverflowPromote, "%", minInt, &Integer{Value: -1}, "0"},
+	}
+
+	for _, tt := range tests {
+		Overflow = tt.mode
+		result := IntegerArithmetic(tt.operator, tt.left, tt.right)
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s %s %s: got=%s, want=%s",
+				tt.left.Inspect(), tt.operator, tt.right.Inspect(), result.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestBigIntNormalize(t *testing.T) {
+	defer func(mode OverflowMode) { Overflow = mode }(Overflow)
+	Overflow = OverflowPromote
+
+	big := IntegerArithmetic("+", &Integer{Value: 9223372036854775807}, &Integer{Value: 1})
+	if _, ok := big.(*BigInt); !ok {
+		t.Fatalf("result is not BigInt. got=%T", big)
+	}
+
+	if result := IntegerArithmetic("/", big, &Integer{Value: 0}); result.Inspect() != "Error: division by zero" {
+		t.Errorf("wrong result for division by zero. got=%s", result.Inspect())
+	}
+
+	result := IntegerArithmetic("-", big, &Integer{Value: 1})
+	integer, ok := result.(*Integer)
+	if !ok {
+		t.Fatalf("result is not normalized to Integer. got=%T", result)
+	}
+	if integer.Value != 9223372036854775807 {
+		t.Errorf("wrong value. got=%d", integer.Value)
+	}
+
+	if CompareIntegers(big, integer) <= 0 {
+		t.Errorf("BigInt should be greater than MaxInt64")
+	}
+}
@@ -0,0 +1,569 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+
+// 内置函数，求值器和虚拟机共用
+// 编译器按照在这里的下标引用内置函数
+// 内置函数返回 nil 表示没有返回值，由调用方转换成 null
+var Builtins = []struct {
+	Name string
+	Builtin *Builtin
+}{
+	// len 对字符串返回字符（rune）数，和 for-in 遍历字符串的次数一致
+	{"len", &Builtin{
+		Fn: func(args ...Object) Object { 
+			if len(args) != 1 { 
+				return newError("wrong number of arguments. got=%d, want=1", 
+				len(args)) 
+			}
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{
+					Value: int64(utf8.RuneCountInString(arg.Value)),
+				}
+			case *Array:
+				return &Integer{
+					Value: int64(arg.Len()),
+				}
+			default: 
+ 				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		}, 
+	}},
+	// 数值类型转换，float 转 int 时向零取整；也可以解析字符串
+	{"int", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Integer, *BigInt:
+				return arg
+			case *Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) ||
+					arg.Value >= math.MaxInt64 || arg.Value < math.MinInt64 {
+					return newError("cannot convert %s to INTEGER", arg.Inspect())
+				}
+				return &Integer{Value: int64(arg.Value)}
+			case *String:
+				value, err := strconv.ParseInt(arg.Value, 0, 64)
+				if err != nil {
+					return newError("could not parse %q as integer", arg.Value)
+				}
+				return &Integer{Value: value}
+			default:
+				return newError("argument to `int` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{"float", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Integer, *BigInt:
+				return &Float{Value: IntegerToFloat(arg)}
+			case *Float:
+				return arg
+			case *String:
+				value, err := strconv.ParseFloat(arg.Value, 64)
+				if err != nil {
+					return newError("could not parse %q as float", arg.Value)
+				}
+				return &Float{Value: value}
+			default:
+				return newError("argument to `float` not supported, got %s", args[0].Type())
+			}
+		},
+	}},
+	{"first", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 { 
+				return newError("wrong number of arguments. got=%d, want=1", len(args)) 
+			} 
+			if args[0].Type() != ARRAY_OBJ { 
+				return newError("argument to `first` must be ARRAY, got %s", args[0].Type()) 
+			} 
+			arr := args[0].(*Array) 
+			if arr.Len() > 0 {
+				return arr.At(0)
+			}
+			return nil
+		},
+	}},
+	{"last", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 { 
+				return newError("wrong number of arguments. got=%d, want=1", len(args)) 
+			} 
+			if args[0].Type() != ARRAY_OBJ { 
+				return newError("argument to `last` must be ARRAY, got %s", args[0].Type()) 
+			} 
+			arr := args[0].(*Array) 
+			length := arr.Len()
+			if length > 0 {
+				return arr.At(length - 1)
+			}
+			return nil
+		},
+	}},
+	{"rest", &Builtin{
+		Fn: func(args ...Object) Object { 
+			if len(args) != 1 { 
+				return newError("wrong number of arguments. got=%d, want=1", 
+				len(args)) 
+			} 
+			if args[0].Type() != ARRAY_OBJ { 
+				return newError("argument to `rest` must be ARRAY, got %s", 
+				args[0].Type()) 
+			} 
+			arr := args[0].(*Array) 
+			if arr.Len() > 0 {
+				return arr.Rest()
+			}
+			return nil 
+		}, 
+	}},
+	{"push", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 { 
+				return newError("wrong number of arguments. got=%d, want=2", len(args)) 
+			} 
+			if args[0].Type() != ARRAY_OBJ { 
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type()) 
+			} 
+			arr := args[0].(*Array) 
+			return arr.Push(args[1])
+		},
+	}},
+	{"set", &Builtin{
+		Fn: func(args ...Object) Object {
+			// 返回修改了第 index 个元素的新数组，原来的数组不变
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `set` must be ARRAY, got %s", args[0].Type())
+			}
+			if args[1].Type() != INTEGER_OBJ {
+				return newError("index to `set` must be INTEGER, got %s", args[1].Type())
+			}
+			arr := args[0].(*Array)
+			index := args[1].(*Integer).Value
+			if index < 0 || index >= int64(arr.Len()) {
+				return newError("index out of range: %d", index)
+			}
+			return arr.With(int(index), args[2])
+		},
+	}},
+	{"keys", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+			}
+			pairs := args[0].(*Hash).Pairs()
+			elements := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Key
+			}
+			return NewArray(elements)
+		},
+	}},
+	{"values", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `values` must be HASH, got %s", args[0].Type())
+			}
+			pairs := args[0].(*Hash).Pairs()
+			elements := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Value
+			}
+			return NewArray(elements)
+		},
+	}},
+	{"entries", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `entries` must be HASH, got %s", args[0].Type())
+			}
+			pairs := args[0].(*Hash).Pairs()
+			elements := make([]Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = NewArray([]Object{pair.Key, pair.Value})
+			}
+			return NewArray(elements)
+		},
+	}},
+	{"has", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `has` must be HASH, got %s", args[0].Type())
+			}
+			if !IsHashable(args[1]) {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			if _, ok := args[0].(*Hash).Get(args[1]); ok {
+				return TRUE
+			}
+			return FALSE
+		},
+	}},
+	{"put", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `put` must be HASH, got %s", args[0].Type())
+			}
+			if !IsHashable(args[1]) {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			result := args[0].(*Hash).copy()
+			result.Set(args[1], args[2])
+			return result
+		},
+	}},
+	{"delete", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+			}
+			if !IsHashable(args[1]) {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			result := &Hash{}
+			for _, pair := range args[0].(*Hash).Pairs() {
+				if !Equals(pair.Key, args[1]) {
+					result.Set(pair.Key, pair.Value)
+				}
+			}
+			return result
+		},
+	}},
+	{"merge", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			for _, arg := range args {
+				if arg.Type() != HASH_OBJ {
+					return newError("argument to `merge` must be HASH, got %s", arg.Type())
+				}
+			}
+			// 第二个 hash 中的值覆盖第一个，新的 key 排在后面
+			result := args[0].(*Hash).copy()
+			for _, pair := range args[1].(*Hash).Pairs() {
+				result.Set(pair.Key, pair.Value)
+			}
+			return result
+		},
+	}},
+	{"map", &Builtin{
+		FnWithCall: func(call CallFunction, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `map` must be ARRAY, got %s", args[0].Type())
+			}
+			elements := args[0].(*Array).Elements()
+			result := make([]Object, len(elements))
+			for i, element := range elements {
+				value := call(args[1], element)
+				if isError(value) {
+					return value
+				}
+				result[i] = value
+			}
+			return NewArray(result)
+		},
+	}},
+	{"filter", &Builtin{
+		FnWithCall: func(call CallFunction, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `filter` must be ARRAY, got %s", args[0].Type())
+			}
+			result := []Object{}
+			for _, element := range args[0].(*Array).Elements() {
+				keep := call(args[1], element)
+				if isError(keep) {
+					return keep
+				}
+				if isTruthy(keep) {
+					result = append(result, element)
+				}
+			}
+			return NewArray(result)
+		},
+	}},
+	{"reduce", &Builtin{
+		FnWithCall: func(call CallFunction, args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `reduce` must be ARRAY, got %s", args[0].Type())
+			}
+			// reduce(arr, fn(acc, x) { ... }, initial)
+			acc := args[2]
+			for _, element := range args[0].(*Array).Elements() {
+				acc = call(args[1], acc, element)
+				if isError(acc) {
+					return acc
+				}
+			}
+			return acc
+		},
+	}},
+	{"sort", &Builtin{
+		FnWithCall: func(call CallFunction, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `sort` must be ARRAY, got %s", args[0].Type())
+			}
+			elements := args[0].(*Array).Elements()
+			result := make([]Object, len(elements))
+			copy(result, elements)
+
+			// 没有比较函数时按照数值或者字符串的顺序排序
+			// 有比较函数时 less(a, b) 为真表示 a 排在 b 前面
+			var err Object
+			sort.SliceStable(result, func(i, j int) bool {
+				if err != nil {
+					return false
+				}
+				if len(args) == 1 {
+					cmp, cmpErr := compareForSort(result[i], result[j])
+					err = cmpErr
+					return cmp < 0
+				}
+				less := call(args[1], result[i], result[j])
+				if isError(less) {
+					err = less
+					return false
+				}
+				return isTruthy(less)
+			})
+			if err != nil {
+				return err
+			}
+			return NewArray(result)
+		},
+	}},
+	{"any", &Builtin{
+		FnWithCall: func(call CallFunction, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `any` must be ARRAY, got %s", args[0].Type())
+			}
+			for _, element := range args[0].(*Array).Elements() {
+				result := call(args[1], element)
+				if isError(result) {
+					return result
+				}
+				if isTruthy(result) {
+					return TRUE
+				}
+			}
+			return FALSE
+		},
+	}},
+	{"all", &Builtin{
+		FnWithCall: func(call CallFunction, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `all` must be ARRAY, got %s", args[0].Type())
+			}
+			for _, element := range args[0].(*Array).Elements() {
+				result := call(args[1], element)
+				if isError(result) {
+					return result
+				}
+				if !isTruthy(result) {
+					return FALSE
+				}
+			}
+			return TRUE
+		},
+	}},
+	{"zip", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			for _, arg := range args {
+				if arg.Type() != ARRAY_OBJ {
+					return newError("argument to `zip` must be ARRAY, got %s", arg.Type())
+				}
+			}
+			// 长度以较短的数组为准
+			left := args[0].(*Array).Elements()
+			right := args[1].(*Array).Elements()
+			length := len(left)
+			if len(right) < length {
+				length = len(right)
+			}
+			result := make([]Object, length)
+			for i := 0; i < length; i++ {
+				result[i] = NewArray([]Object{left[i], right[i]})
+			}
+			return NewArray(result)
+		},
+	}},
+	{"range", &Builtin{
+		Fn: func(args ...Object) Object {
+			// range(end)、range(start, end)、range(start, end, step)，不包括 end
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+			}
+			bounds := []int64{0, 0, 1}
+			for i, arg := range args {
+				integer, ok := arg.(*Integer)
+				if !ok {
+					return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = integer.Value
+			}
+			if len(args) == 1 {
+				bounds[0], bounds[1] = 0, bounds[0]
+			}
+			start, end, step := bounds[0], bounds[1], bounds[2]
+			if step == 0 {
+				return newError("`range` step must not be zero")
+			}
+
+			result := []Object{}
+			for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+				result = append(result, &Integer{Value: i})
+			}
+			return NewArray(result)
+		},
+	}},
+	{"flatten", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `flatten` must be ARRAY, got %s", args[0].Type())
+			}
+			// 只展开一层，不是数组的元素保持不变
+			result := []Object{}
+			for _, element := range args[0].(*Array).Elements() {
+				if inner, ok := element.(*Array); ok {
+					result = append(result, inner.Elements()...)
+				} else {
+					result = append(result, element)
+				}
+			}
+			return NewArray(result)
+		},
+	}},
+	{"throw", &Builtin{
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if str, ok := args[0].(*String); ok {
+				return &Error{Message: str.Value, Value: str}
+			}
+			return &Error{Message: args[0].Inspect(), Value: args[0]}
+		},
+	}},
+	{"puts", &Builtin{
+		Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+			return nil
+		},
+	}},
+}
+
+
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+
+func isError(obj Object) bool {
+	return obj != nil && obj.Type() == ERROR_OBJ
+}
+
+// 和求值器、虚拟机的判断一致：false 和 null 为假，其他都为真
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+// sort 默认的比较：数值之间按照数值，字符串之间按照 Unicode 码点的顺序
+func compareForSort(a, b Object) (int, Object) {
+	switch {
+	case IsInteger(a) && IsInteger(b):
+		return CompareIntegers(a, b), nil
+	case isNumeric(a) && isNumeric(b):
+		x, y := toFloat64(a), toFloat64(b)
+		if x < y {
+			return -1, nil
+		} else if x > y {
+			return 1, nil
+		}
+		return 0, nil
+	case a.Type() == STRING_OBJ && b.Type() == STRING_OBJ:
+		return strings.Compare(a.(*String).Value, b.(*String).Value), nil
+	default:
+		return 0, newError("cannot compare %s with %s", a.Type(), b.Type())
+	}
+}
+
+func newError(format string, args ...interface{}) *Error {
+	return &Error{
+		Message: fmt.Sprintf(format, args...),
+	}
+}
@@ -1,11 +1,13 @@
 package object
 
+import "sort"
 
 
-
+// 变量的作用域，通过 outer 串成一条作用域链
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	frame *Frame // 函数调用创建的环境所对应的栈帧
 }
 
 func NewEnvironment() *Environment {
@@ -15,21 +17,74 @@ func NewEnvironment() *Environment {
 	}
 }
 
+// 从当前环境开始沿着外层环境查找
 func (e *Environment) Get(key string) (Object, bool) {
-	obj, ok := e.store[key]
-	return obj, ok
-
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.store[key]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
 }
 
-func (e *Environment) Set(key string, obj Object) Object {
+// 在当前环境中创建绑定，会遮蔽外层环境中的同名变量，let、函数参数使用
+func (e *Environment) Define(key string, obj Object) Object {
 	e.store[key] = obj
 	return obj
 }
 
+// 修改已有的绑定，从当前环境开始沿着外层环境查找最近的一个
+// 名字没有定义过时返回 false
+func (e *Environment) Assign(key string, obj Object) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[key]; ok {
+			env.store[key] = obj
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+// 当前环境中定义的名字，按字母顺序排列，不包括外层环境
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 外层环境，全局环境返回 nil
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// 当前环境所在的函数调用，不在函数中时为 nil
+func (e *Environment) Frame() *Frame {
+	return e.frame
+}
+
+// 外层环境的层数，全局环境为 0
+func (e *Environment) Depth() int {
+	depth := 0
+	for env := e.outer; env != nil; env = env.outer {
+		depth++
+	}
+	return depth
+}
+
 
 // 扩展环境
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
 	return env
-}
\ No newline at end of file
+}
+
+// 调用函数时创建的环境，outer 是函数定义时的环境
+func NewFunctionEnvironment(outer *Environment, frame *Frame) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.frame = frame
+	return env
+}
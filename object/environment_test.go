@@ -0,0 +1,108 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvironmentScopeChain(t *testing.T) {
+	global := NewEnvironment()
+	global.Define("a", &Integer{Value: 1})
+	global.Define("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(global)
+	inner.Define("b", &Integer{Value: 20})
+
+	tests := []struct {
+		name     string
+		expected int64
+	}{
+		{"a", 1},  // 来自外层环境
+		{"b", 20}, // 遮蔽了外层的 b
+	}
+	for _, tt := range tests {
+		obj, ok := inner.Get(tt.name)
+		if !ok {
+			t.Fatalf("%s not found", tt.name)
+		}
+		if obj.(*Integer).Value != tt.expected {
+			t.Errorf("%s has wrong value. want=%d, got=%s", tt.name, tt.expected, obj.Inspect())
+		}
+	}
+
+	if _, ok := inner.Get("c"); ok {
+		t.Errorf("c should not be found")
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	global := NewEnvironment()
+	global.Define("a", &Integer{Value: 1})
+	global.Define("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(global)
+	inner.Define("b", &Integer{Value: 20})
+
+	// 修改最近的绑定
+	if _, ok := inner.Assign("a", &Integer{Value: 10}); !ok {
+		t.Fatalf("assign to a failed")
+	}
+	if _, ok := inner.Assign("b", &Integer{Value: 200}); !ok {
+		t.Fatalf("assign to b failed")
+	}
+
+	a, _ := global.Get("a")
+	if a.(*Integer).Value != 10 {
+		t.Errorf("global a not updated. got=%s", a.Inspect())
+	}
+	b, _ := global.Get("b")
+	if b.(*Integer).Value != 2 {
+		t.Errorf("global b should not change. got=%s", b.Inspect())
+	}
+	b, _ = inner.Get("b")
+	if b.(*Integer).Value != 200 {
+		t.Errorf("inner b not updated. got=%s", b.Inspect())
+	}
+
+	// 没有定义过的名字不能赋值，也不会被创建
+	if _, ok := inner.Assign("c", &Integer{Value: 3}); ok {
+		t.Errorf("assign to undefined c should fail")
+	}
+	if _, ok := inner.Get("c"); ok {
+		t.Errorf("c should not be created by a failed assign")
+	}
+}
+
+func TestEnvironmentIntrospection(t *testing.T) {
+	global := NewEnvironment()
+	global.Define("b", &Integer{Value: 2})
+	global.Define("a", &Integer{Value: 1})
+
+	inner := NewEnclosedEnvironment(global)
+	inner.Define("x", &Integer{Value: 3})
+	innermost := NewEnclosedEnvironment(inner)
+
+	if names := global.Names(); !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("wrong global names. got=%v", names)
+	}
+	if names := inner.Names(); !reflect.DeepEqual(names, []string{"x"}) {
+		t.Errorf("wrong inner names. got=%v", names)
+	}
+	if names := innermost.Names(); len(names) != 0 {
+		t.Errorf("innermost should have no names. got=%v", names)
+	}
+
+	if global.Outer() != nil {
+		t.Errorf("global.Outer() should be nil")
+	}
+	if innermost.Outer() != inner || inner.Outer() != global {
+		t.Errorf("Outer() does not return the enclosing environment")
+	}
+
+	if d := global.Depth(); d != 0 {
+		t.Errorf("global depth should be 0. got=%d", d)
+	}
+	if d := innermost.Depth(); d != 2 {
+		t.Errorf("innermost depth should be 2. got=%d", d)
+	}
+}
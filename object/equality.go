@@ -0,0 +1,90 @@
+package object
+
+// 结构相等，== 和 != 使用
+// 数值之间按照数值比较，整数和浮点数混合时整数先转换为浮点数；
+// 字符串、布尔值和 null 比较值；数组和 hash 逐个比较元素；
+// 其他类型（函数、内置函数等）只和自身相等。
+// NaN 和任何值都不相等，包括它自己；数组和 hash 没有先判断是不是同一个对象，
+// 所以 [n] == [n] 和 n == n 一样，在 n 是 NaN 时为 false
+func Equals(a, b Object) bool {
+	return equals(a, b, nil)
+}
+
+// 正在比较的一对数组或 hash，数组可以通过下标赋值包含自身，遇到正在比较的一对时认为相等
+type comparing struct {
+	a, b Object
+}
+
+func equals(a, b Object, seen map[comparing]bool) bool {
+	if IsInteger(a) && IsInteger(b) {
+		return CompareIntegers(a, b) == 0
+	}
+	if isNumeric(a) && isNumeric(b) {
+		return toFloat64(a) == toFloat64(b)
+	}
+
+	switch a := a.(type) {
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		if seen, ok = enter(seen, a, b); !ok {
+			return true
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !equals(a.At(i), b.At(i), seen) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		if seen, ok = enter(seen, a, b); !ok {
+			return true
+		}
+		for _, pair := range a.Pairs() {
+			other, ok := b.Get(pair.Key)
+			if !ok || !equals(pair.Value, other, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// 记录开始比较的一对对象，已经在比较中时返回 false
+func enter(seen map[comparing]bool, a, b Object) (map[comparing]bool, bool) {
+	if seen == nil {
+		seen = make(map[comparing]bool)
+	}
+	if seen[comparing{a, b}] {
+		return seen, false
+	}
+	seen[comparing{a, b}] = true
+	return seen, true
+}
+
+func isNumeric(obj Object) bool {
+	return IsInteger(obj) || obj.Type() == FLOAT_OBJ
+}
+
+func toFloat64(obj Object) float64 {
+	if f, ok := obj.(*Float); ok {
+		return f.Value
+	}
+	return IntegerToFloat(obj)
+}
@@ -0,0 +1,51 @@
+package object
+
+import (
+	"fmt"
+	"monkey/token"
+	"strings"
+)
+
+// 求值器中一次函数调用的栈帧，通过 Caller 串成调用栈
+type Frame struct {
+	Name    string         // 函数名，匿名函数为 <anonymous>
+	CallPos token.Position // 调用处的位置
+	Caller  *Frame         // 调用者的栈帧，顶层的调用为 nil
+	Depth   int            // 调用深度，顶层的调用为 1
+
+	// 在这个栈帧和 Caller 之间被尾调用替换掉、没有保留下来的栈帧个数
+	TailCalls int
+}
+
+// 打印调用栈时最多显示的栈帧数，超出的部分省略中间的栈帧
+const maxTracebackFrames = 20
+
+// 从最内层开始，每个栈帧一行
+func (f *Frame) Traceback() string {
+	lines := []string{}
+	head := maxTracebackFrames / 2
+	tail := maxTracebackFrames - head
+	for frame := f; frame != nil; frame = frame.Caller {
+		i := f.Depth - frame.Depth
+		if f.Depth > maxTracebackFrames && i >= head && frame.Depth > tail {
+			if i == head {
+				lines = append(lines, fmt.Sprintf("\t... %d more frames", f.Depth-maxTracebackFrames))
+			}
+			continue
+		}
+		lines = append(lines, "\tat "+frame.String())
+		if frame.TailCalls > 0 {
+			lines = append(lines, "\t"+frame.tailCallsString())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (f *Frame) tailCallsString() string {
+	return fmt.Sprintf("... %d tail calls", f.TailCalls)
+}
+
+// 函数名和调用处的位置
+func (f *Frame) String() string {
+	return fmt.Sprintf("%s (%s)", f.Name, f.CallPos)
+}
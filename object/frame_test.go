@@ -0,0 +1,88 @@
+package object
+
+import (
+	"monkey/token"
+	"strings"
+	"testing"
+)
+
+func buildStack(depth int) *Frame {
+	var frame *Frame
+	for i := 1; i <= depth; i++ {
+		frame = &Frame{
+			Name:    "f",
+			CallPos: token.Position{Line: i, Column: 1},
+			Caller:  frame,
+			Depth:   i,
+		}
+	}
+	return frame
+}
+
+func TestFrameTraceback(t *testing.T) {
+	frame := &Frame{
+		Name:    "inner",
+		CallPos: token.Position{Line: 3, Column: 5},
+		Caller: &Frame{
+			Name:    "<anonymous>",
+			CallPos: token.Position{Line: 7, Column: 1},
+			Depth:   1,
+		},
+		Depth: 2,
+	}
+	expected := "\tat inner (3:5)\n\tat <anonymous> (7:1)"
+	if frame.Traceback() != expected {
+		t.Errorf("wrong traceback. want=%q, got=%q", expected, frame.Traceback())
+	}
+}
+
+func TestFrameTracebackTailCalls(t *testing.T) {
+	frame := &Frame{
+		Name:      "loop",
+		CallPos:   token.Position{Line: 2, Column: 9},
+		TailCalls: 3,
+		Caller: &Frame{
+			Name:    "main",
+			CallPos: token.Position{Line: 5, Column: 1},
+			Depth:   1,
+		},
+		Depth: 2,
+	}
+	expected := "\tat loop (2:9)\n\t... 3 tail calls\n\tat main (5:1)"
+	if frame.Traceback() != expected {
+		t.Errorf("wrong traceback. want=%q, got=%q", expected, frame.Traceback())
+	}
+}
+
+func TestFrameTracebackTruncated(t *testing.T) {
+	lines := strings.Split(buildStack(100).Traceback(), "\n")
+	if len(lines) != maxTracebackFrames+1 {
+		t.Fatalf("wrong number of lines. want=%d, got=%d", maxTracebackFrames+1, len(lines))
+	}
+	if lines[0] != "\tat f (100:1)" {
+		t.Errorf("wrong innermost frame. got=%q", lines[0])
+	}
+	if lines[10] != "\t... 80 more frames" {
+		t.Errorf("wrong omitted line. got=%q", lines[10])
+	}
+	if lines[len(lines)-1] != "\tat f (1:1)" {
+		t.Errorf("wrong outermost frame. got=%q", lines[len(lines)-1])
+	}
+
+	// 刚好达到上限时不省略
+	lines = strings.Split(buildStack(maxTracebackFrames).Traceback(), "\n")
+	if len(lines) != maxTracebackFrames {
+		t.Errorf("wrong number of lines. want=%d, got=%d", maxTracebackFrames, len(lines))
+	}
+}
+
+func TestErrorTraceback(t *testing.T) {
+	err := &Error{Message: "boom", Pos: token.Position{Line: 1, Column: 2}}
+	if err.Traceback() != "Error: 1:2: boom" {
+		t.Errorf("wrong traceback without stack. got=%q", err.Traceback())
+	}
+	err.Stack = buildStack(1)
+	if err.Traceback() != "Error: 1:2: boom\n\tat f (1:1)" {
+		t.Errorf("wrong traceback with stack. got=%q", err.Traceback())
+	}
+}
@@ -0,0 +1,108 @@
+package object
+
+import "hash/fnv"
+
+// 数组、hash 和 null 也可以作为 hash 的 key
+// 数组和 hash 按照内容计算 HashKey，和 Equals 保持一致：
+// 数组依次组合元素的 HashKey，hash 与键值对的顺序无关
+// 保存到 hash 中的 key 是冻结的副本，之后修改原来的数组不会影响 hash
+
+const (
+	fnvOffset uint64 = 14695981039346656037
+	fnvPrime  uint64 = 1099511628211
+)
+
+func (n *Null) HashKey() HashKey {
+	return HashKey{Type: n.Type(), Value: 0}
+}
+
+func (a *Array) HashKey() HashKey {
+	value := fnvOffset
+	for _, element := range a.Elements() {
+		value = mixHashKey(value, element.(Hashable).HashKey())
+	}
+	return HashKey{Type: a.Type(), Value: value}
+}
+
+func (h *Hash) HashKey() HashKey {
+	var value uint64
+	for _, pair := range h.pairs {
+		pairValue := mixHashKey(fnvOffset, pair.Key.(Hashable).HashKey())
+		pairValue = mixHashKey(pairValue, pair.Value.(Hashable).HashKey())
+		value += pairValue
+	}
+	return HashKey{Type: h.Type(), Value: value}
+}
+
+func mixHashKey(value uint64, key HashKey) uint64 {
+	t := fnv.New64a()
+	t.Write([]byte(key.Type))
+	value = (value ^ t.Sum64()) * fnvPrime
+	return (value ^ key.Value) * fnvPrime
+}
+
+// 能否作为 hash 的 key：实现了 Hashable，数组和 hash 还要求其中的元素都能作为 key
+// 包含自身的数组和 hash 不能作为 key
+func IsHashable(obj Object) bool {
+	return isHashable(obj, map[Object]bool{})
+}
+
+func isHashable(obj Object, visiting map[Object]bool) bool {
+	if _, ok := obj.(Hashable); !ok {
+		return false
+	}
+
+	var elements []Object
+	switch obj := obj.(type) {
+	case *Array:
+		elements = obj.Elements()
+	case *Hash:
+		for _, pair := range obj.pairs {
+			elements = append(elements, pair.Key, pair.Value)
+		}
+	default:
+		return true
+	}
+
+	if visiting[obj] {
+		return false
+	}
+	visiting[obj] = true
+	defer delete(visiting, obj)
+
+	for _, element := range elements {
+		if !isHashable(element, visiting) {
+			return false
+		}
+	}
+	return true
+}
+
+// 数组和 hash 作为 key 时保存一个冻结的副本
+func freezeKey(key Object) Object {
+	switch key := key.(type) {
+	case *Array:
+		if key.Frozen {
+			return key
+		}
+		elements := key.Elements()
+		for i, element := range elements {
+			elements[i] = freezeKey(element)
+		}
+		frozen := NewArray(elements)
+		frozen.Frozen = true
+		return frozen
+	case *Hash:
+		if key.Frozen {
+			return key
+		}
+		frozen := &Hash{}
+		for _, pair := range key.pairs {
+			frozen.Set(freezeKey(pair.Key), freezeKey(pair.Value))
+		}
+		frozen.Frozen = true
+		return frozen
+	default:
+		return key
+	}
+}
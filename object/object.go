@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math/big"
 	"monkey/ast"
+	"monkey/code"
+	"monkey/token"
+	"strconv"
 	"strings"
 )
 
@@ -17,9 +21,13 @@ type Object interface {
 
 const (
 	INTEGER_OBJ = "INTEGER"
+	BIGINT_OBJ = "BIGINT"
+	FLOAT_OBJ = "FLOAT"
 	BOOLEAN_OBJ = "BOOLEAN"
 	NULL_OBJ = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ = "BREAK"
+	CONTINUE_OBJ = "CONTINUE"
 	ERROR_OBJ = "ERROR_OBJ"  // TODO：这里是不是有问题
 	FUNCTION_OBJ = "FUNCTION"
 	STRING_OBJ = "STRING"
@@ -27,6 +35,9 @@ const (
 	ARRAY_OBJ = "ARRAY"
 	HASH_OBJ = "HASH"
 	QUOTE_OBJ = "QUOTE"
+	MACRO_OBJ = "MACRO"
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CLOSURE_OBJ = "CLOSURE"
 )
 
 
@@ -42,8 +53,46 @@ func (i *Integer) Type() ObjectType {
 	return INTEGER_OBJ
 }
 
+// 任意精度的整数，只在开启 OverflowPromote 后由整数运算溢出产生
+// 值在 int64 范围内时总是用 Integer 表示
+type BigInt struct {
+	Value *big.Int
+}
+
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+func (b *BigInt) Type() ObjectType {
+	return BIGINT_OBJ
+}
+
+
+// 浮点数
+type Float struct {
+	Value float64
+}
+//
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	// 整数值的浮点数也带上小数点，和 Integer 区分开
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
 
 // bool
+// 布尔值只有两个实例，null 只有一个实例，求值器、虚拟机和内置函数共用
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 type Boolean struct {
 	Value bool
 }
@@ -79,22 +128,98 @@ func (rv *ReturnValue) Type() ObjectType {
 	return RETURN_VALUE_OBJ
 }
 
+// break 和 continue，和 ReturnValue 一样沿着语句块向上传递，由循环处理
+type Break struct{}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+type Continue struct{}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
 
 // error
 type Error struct {
 	Message string
+	Pos token.Position // 出错的节点在源码中的位置
+	Stack *Frame // 出错时所在的栈帧，在顶层出错时为 nil
+	Value Object // throw 抛出的值，其他错误为 nil
 }
 //
 func (e *Error) Inspect() string {
-	return "Error:" + e.Message
+	if e.Pos.IsValid() {
+		return "Error: " + e.Pos.String() + ": " + e.Message
+	}
+	return "Error: " + e.Message
 }
 func (e *Error) Type() ObjectType {
 	return ERROR_OBJ
 }
 
+// 错误信息以及 Monkey 的调用栈
+func (e *Error) Traceback() string {
+	if e.Stack == nil {
+		return e.Inspect()
+	}
+	return e.Inspect() + "\n" + e.Stack.Traceback()
+}
+
+// 虚拟机把 Error 直接作为 Go 的 error 返回
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// catch 得到的对象，包含 message、position、stack 和 value 四个字段
+// 没有位置时 position 为 null，value 是 throw 的参数，其他错误为 message
+func (e *Error) Hash() *Hash {
+	var position Object = NULL
+	if e.Pos.IsValid() {
+		position = &String{Value: e.Pos.String()}
+	}
+
+	stack := []Object{}
+	for frame := e.Stack; frame != nil; frame = frame.Caller {
+		stack = append(stack, &String{Value: frame.String()})
+		if frame.TailCalls > 0 {
+			stack = append(stack, &String{Value: frame.tailCallsString()})
+		}
+	}
+
+	value := e.Value
+	if value == nil {
+		value = &String{Value: e.Message}
+	}
+
+	fields := []struct {
+		name  string
+		value Object
+	}{
+		{"message", &String{Value: e.Message}},
+		{"position", position},
+		{"stack", NewArray(stack)},
+		{"value", value},
+	}
+	hash := &Hash{}
+	for _, field := range fields {
+		hash.Set(&String{Value: field.name}, field.value)
+	}
+	return hash
+}
+
 
 // function
 type Function struct {
+	Name string // let 绑定的名字，匿名函数为空
 	Parameters []*ast.Identifier
 	Body *ast.BlockStatement
 	Env *Environment
@@ -133,8 +258,20 @@ func (s *String) Type() ObjectType {
 
 type BuiltinFunction func (args ...Object) Object
 
+// 调用 Monkey 函数或者内置函数，由求值器和虚拟机提供，出错时返回 *Error
+type CallFunction func(fn Object, args ...Object) Object
+
 type Builtin struct {
 	Fn BuiltinFunction
+	// 需要回调函数参数的内置函数（map、filter 等）使用 FnWithCall，这时 Fn 为 nil
+	FnWithCall func(call CallFunction, args ...Object) Object
+}
+
+func (b *Builtin) Call(call CallFunction, args ...Object) Object {
+	if b.FnWithCall != nil {
+		return b.FnWithCall(call, args...)
+	}
+	return b.Fn(args...)
 }
 func (b *Builtin) Inspect() string {
 	return "built-in function"
@@ -144,25 +281,106 @@ func (b *Builtin) Type() ObjectType {
 }
 
 
+// 数组的元素保存在持久化的 vector 中，push、rest 等返回新数组的操作和原来的数组共享存储
 type Array struct {
-	Elements []Object
+	elements vector
+	Frozen   bool // 作为 hash 的 key 保存的数组不能再修改
+}
+
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
+}
+
+func (a *Array) Len() int {
+	return a.elements.len()
+}
+
+// 下标需要在 0 到 Len()-1 之间
+func (a *Array) At(i int) Object {
+	return a.elements.get(i)
+}
+
+// 返回所有元素的副本，修改它不会影响数组
+func (a *Array) Elements() []Object {
+	return a.elements.slice()
+}
+
+// 就地修改第 i 个元素，下标赋值使用
+func (a *Array) Set(i int, value Object) {
+	a.elements = a.elements.set(i, value)
+}
+
+// 下面几个方法返回新的数组，不改变 a
+func (a *Array) With(i int, value Object) *Array {
+	return &Array{elements: a.elements.set(i, value)}
+}
+
+func (a *Array) Push(value Object) *Array {
+	return &Array{elements: a.elements.push(value)}
+}
+
+func (a *Array) Rest() *Array {
+	return &Array{elements: a.elements.rest()}
 }
+
 func (a *Array) Inspect() string {
-	var out bytes.Buffer 
-	elements := []string{} 
-	for _, e := range a.Elements { 
-		elements = append(elements, e.Inspect()) 
-	} 
-	out.WriteString("[") 
-	out.WriteString(strings.Join(elements, ", ")) 
-	out.WriteString("]")
-	return out.String()
+	return inspect(a, nil)
+}
+
+// 数组和 hash 可以通过下标赋值包含自身，遇到正在打印的数组或 hash 时打印 [...] 或 {...}
+func inspect(obj Object, visiting map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return "[...]"
+		}
+		visiting = visit(visiting, obj)
+		defer delete(visiting, obj)
+
+		var out bytes.Buffer 
+		elements := []string{} 
+		for _, e := range obj.Elements() { 
+			elements = append(elements, inspect(e, visiting)) 
+		} 
+		out.WriteString("[") 
+		out.WriteString(strings.Join(elements, ", ")) 
+		out.WriteString("]")
+		return out.String()
+	case *Hash:
+		if visiting[obj] {
+			return "{...}"
+		}
+		visiting = visit(visiting, obj)
+		defer delete(visiting, obj)
+
+		var out bytes.Buffer 
+		pairs := []string{} 
+		for _, pair := range obj.pairs { 
+			pairs = append(pairs, fmt.Sprintf("%s: %s", inspect(pair.Key, visiting), inspect(pair.Value, visiting))) 
+		} 
+		out.WriteString("{") 
+		out.WriteString(strings.Join(pairs, ", ")) 
+		out.WriteString("}") 
+		return out.String()
+	default:
+		return obj.Inspect()
+	}
+}
+
+func visit(visiting map[Object]bool, obj Object) map[Object]bool {
+	if visiting == nil {
+		visiting = make(map[Object]bool)
+	}
+	visiting[obj] = true
+	return visiting
 }
 func (a *Array) Type() ObjectType {
 	return ARRAY_OBJ
 }
 
 
+// 可以作为 hash 的 key，相等的 key 必须有相同的 HashKey，
+// 但 HashKey 相同的 key 不一定相等，Hash 会再用 Equals 比较 key 本身
 type Hashable interface {
 	HashKey() HashKey
 }
@@ -191,7 +409,19 @@ func (i *Integer) HashKey() HashKey {
 		Value: uint64(i.Value),
 	}
 }
-// TODO:该方法存在哈希碰撞的问题，可以尝试解决
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write(b.Value.Bytes())
+	value := h.Sum64()
+	if b.Value.Sign() < 0 {
+		value = ^value
+	}
+	return HashKey{
+		Type: b.Type(),
+		Value: value,
+	}
+}
+// 不同的字符串可能得到相同的 HashKey，由 Hash 处理碰撞
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -207,22 +437,71 @@ type HashPair struct {
 	Value Object
 }
 
+// 按照插入的顺序保存键值对，零值是空的 hash
+// key 必须实现 Hashable，由调用方检查；HashKey 相同的 key 放在同一个桶中，
+// 查找时用 Equals 比较 key 本身，所以 HashKey 碰撞不会互相覆盖
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs []HashPair
+	index map[HashKey][]int // 每个桶中的键值对在 pairs 中的下标
+
+	Frozen bool // 作为 hash 的 key 保存的 hash 不能再修改
 }
+
+// 返回 key 在 pairs 中的下标，不存在时返回 -1
+func (h *Hash) find(hashKey HashKey, key Object) int {
+	for _, i := range h.index[hashKey] {
+		if Equals(h.pairs[i].Key, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *Hash) Get(key Object) (Object, bool) {
+	i := h.find(key.(Hashable).HashKey(), key)
+	if i < 0 {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// key 已经存在时只替换值，保留原来的位置
+func (h *Hash) Set(key, value Object) {
+	hashKey := key.(Hashable).HashKey()
+	if i := h.find(hashKey, key); i >= 0 {
+		h.pairs[i].Value = value
+		return
+	}
+	if h.index == nil {
+		h.index = make(map[HashKey][]int)
+	}
+	h.index[hashKey] = append(h.index[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: freezeKey(key), Value: value})
+}
+
+// 不冻结的浅拷贝，内置函数返回新的 hash 时使用
+func (h *Hash) copy() *Hash {
+	result := &Hash{}
+	for _, pair := range h.pairs {
+		result.Set(pair.Key, pair.Value)
+	}
+	return result
+}
+
+func (h *Hash) Len() int {
+	return len(h.pairs)
+}
+
+// 按照插入顺序返回所有键值对，调用方不能修改返回的切片
+func (h *Hash) Pairs() []HashPair {
+	return h.pairs
+}
+
 func (h *Hash) Type() ObjectType {
 	return HASH_OBJ
 }
 func (h *Hash) Inspect() string {
-	var out bytes.Buffer 
-	pairs := []string{} 
-	for _, pair := range h.Pairs { 
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect())) 
-	} 
-	out.WriteString("{") 
-	out.WriteString(strings.Join(pairs, ", ")) 
-	out.WriteString("}") 
-	return out.String()
+	return inspect(h, nil)
 }
 
 
@@ -235,3 +514,56 @@ func (q *Quote) Type() ObjectType {
 func (q *Quote) Inspect() string {
 	return "Quote(" + q.Node.String() + ")"
 }
+
+
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body *ast.BlockStatement
+	Env *Environment
+}
+func (m *Macro) Type() ObjectType {
+	return MACRO_OBJ
+}
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("macro")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+	return out.String()
+}
+
+
+// 编译后的函数，只在虚拟机中使用
+type CompiledFunction struct {
+	Instructions code.Instructions
+	NumLocals int	// 局部变量个数，包括参数
+	NumParameters int
+	Name string	// 函数名，匿名函数为空
+	SourceMap code.SourceMap	// 指令对应的源码位置
+}
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+
+// 闭包：编译后的函数加上它捕获的自由变量
+type Closure struct {
+	Fn *CompiledFunction
+	Free []Object
+}
+func (c *Closure) Type() ObjectType {
+	return CLOSURE_OBJ
+}
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 
 func TestStringHashKey(t *testing.T) { 
@@ -17,4 +20,174 @@ func TestStringHashKey(t *testing.T) {
 	if hello1.HashKey() == diff1.HashKey() { 
 		t.Errorf("strings with different content have same hash keys") 
 	} 
-}
\ No newline at end of file
+}
+func TestEquals(t *testing.T) {
+	one := &Integer{Value: 1}
+	str := &String{Value: "a"}
+	pairs := func(value Object) *Hash {
+		hash := &Hash{}
+		hash.Set(str, value)
+		return hash
+	}
+	fn := &Builtin{}
+	nan := &Float{Value: math.NaN()}
+	nans := NewArray([]Object{nan})
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{one, &Integer{Value: 1}, true},
+		{one, &Float{Value: 1}, true},
+		{one, &String{Value: "1"}, false},
+		{str, &String{Value: "a"}, true},
+		{&Null{}, &Null{}, true},
+		{NewArray([]Object{one, str}), NewArray([]Object{&Integer{Value: 1}, &String{Value: "a"}}), true},
+		{NewArray([]Object{one}), NewArray([]Object{str}), false},
+		{pairs(NewArray([]Object{one})), pairs(NewArray([]Object{one})), true},
+		{pairs(one), pairs(str), false},
+		{fn, fn, true},
+		{fn, &Builtin{}, false},
+		// NaN 在数组和 hash 中也不等于自身
+		{nan, nan, false},
+		{NewArray([]Object{nan}), NewArray([]Object{nan}), false},
+		{nans, nans, false},
+		{pairs(nan), pairs(nan), false},
+	}
+
+	for i, tt := range tests {
+		if Equals(tt.a, tt.b) != tt.expected {
+			t.Errorf("tests[%d]: Equals(%s, %s) != %t", i, tt.a.Inspect(), tt.b.Inspect(), tt.expected)
+		}
+	}
+}
+
+// HashKey 总是相同的 key，用来制造碰撞
+type collidingKey struct {
+	name string
+}
+
+func (c *collidingKey) Type() ObjectType { return "COLLIDING" }
+func (c *collidingKey) Inspect() string  { return c.name }
+func (c *collidingKey) HashKey() HashKey { return HashKey{Type: STRING_OBJ, Value: 42} }
+
+func TestHashCollisions(t *testing.T) {
+	a := &collidingKey{name: "a"}
+	b := &collidingKey{name: "b"}
+	if a.HashKey() != b.HashKey() {
+		t.Fatalf("keys should collide")
+	}
+
+	hash := &Hash{}
+	hash.Set(a, &Integer{Value: 1})
+	hash.Set(b, &Integer{Value: 2})
+	hash.Set(a, &Integer{Value: 3})
+
+	if hash.Len() != 2 {
+		t.Fatalf("hash has wrong number of pairs. got=%d", hash.Len())
+	}
+	for _, tt := range []struct {
+		key      Object
+		expected int64
+	}{{a, 3}, {b, 2}} {
+		value, ok := hash.Get(tt.key)
+		if !ok {
+			t.Fatalf("no value for key %s", tt.key.Inspect())
+		}
+		if value.(*Integer).Value != tt.expected {
+			t.Errorf("wrong value for key %s. want=%d, got=%d", tt.key.Inspect(), tt.expected, value.(*Integer).Value)
+		}
+	}
+	if _, ok := hash.Get(&collidingKey{name: "c"}); ok {
+		t.Errorf("found a value for a key that was never set")
+	}
+	if hash.Inspect() != "{a: 3, b: 2}" {
+		t.Errorf("wrong Inspect(). got=%s", hash.Inspect())
+	}
+}
+
+func TestCompositeHashKeys(t *testing.T) {
+	array := func(elements ...Object) *Array { return NewArray(elements) }
+	hash := func(pairs ...Object) *Hash {
+		h := &Hash{}
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+	one := &Integer{Value: 1}
+	a := &String{Value: "a"}
+
+	equal := [][2]Hashable{
+		{array(one, a), array(&Integer{Value: 1}, &String{Value: "a"})},
+		{array(), array()},
+		{hash(a, one, one, a), hash(one, a, a, one)},
+		{&Null{}, &Null{}},
+	}
+	for i, tt := range equal {
+		if tt[0].HashKey() != tt[1].HashKey() {
+			t.Errorf("equal[%d]: equal keys have different hash keys", i)
+		}
+	}
+
+	different := [][2]Hashable{
+		{array(one, a), array(a, one)},
+		{array(one), array(array(one))},
+		{hash(a, one), hash(one, a)},
+		{array(), hash()},
+	}
+	for i, tt := range different {
+		if tt[0].HashKey() == tt[1].HashKey() {
+			t.Errorf("different[%d]: different keys have same hash keys", i)
+		}
+	}
+
+	if IsHashable(array(one, &Builtin{})) {
+		t.Errorf("array containing a builtin should not be hashable")
+	}
+	cyclic := array(one)
+	cyclic.Set(0, cyclic)
+	if IsHashable(cyclic) {
+		t.Errorf("cyclic array should not be hashable")
+	}
+
+	key := array(one)
+	h := hash(key, a)
+	key.Set(0, a)
+	if value, ok := h.Get(array(one)); !ok || value != a {
+		t.Errorf("modifying the original array changed the stored key")
+	}
+	if !h.Pairs()[0].Key.(*Array).Frozen {
+		t.Errorf("stored key is not frozen")
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	one := &Integer{Value: 1}
+
+	array := NewArray([]Object{one, one})
+	array.Set(0, array)
+
+	hash := &Hash{}
+	hash.Set(&String{Value: "self"}, hash)
+	hash.Set(&String{Value: "array"}, array)
+
+	// 同一个数组出现两次但没有成环时正常打印
+	shared := NewArray([]Object{one})
+	twice := NewArray([]Object{shared, shared})
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{array, "[[...], 1]"},
+		{hash, "{self: {...}, array: [[...], 1]}"},
+		{NewArray([]Object{hash}), "[{self: {...}, array: [[...], 1]}]"},
+		{twice, "[[1], [1]]"},
+	}
+	for i, tt := range tests {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("tests[%d]: wrong Inspect(). got=%s, want=%s", i, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package object
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// quote 中的 unquote 调用，按照在源码中出现的顺序排列
+// 不进入 unquote 的参数，参数中的 unquote 由参数求值时处理
+func UnquoteCalls(node ast.Node) []*ast.CallExpression {
+	var calls []*ast.CallExpression
+	ast.Inspect(node, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "unquote" {
+			return true
+		}
+		calls = append(calls, call)
+		return false
+	})
+	return calls
+}
+
+// 复制 quote 的 AST，把其中的 unquote 调用按照 UnquoteCalls 的顺序依次
+// 替换成 values 转换成的节点，原来的 AST 保持不变。转换失败时错误的位置是对应的 unquote 调用
+func Unquote(node ast.Node, values []Object) (ast.Node, *Error) {
+	node = ast.Copy(node)
+	calls := UnquoteCalls(node)
+	if len(calls) != len(values) {
+		return nil, newError("wrong number of unquote values. got=%d, want=%d", len(values), len(calls))
+	}
+
+	replacements := make(map[ast.Node]ast.Node, len(calls))
+	for i, call := range calls {
+		converted, err := convertObjectToASTNode(values[i], call.Pos())
+		if err != nil {
+			err.Pos = call.Pos()
+			return nil, err
+		}
+		replacements[call] = converted
+	}
+	return ast.Modify(node, func(node ast.Node) ast.Node {
+		if replacement, ok := replacements[node]; ok {
+			return replacement
+		}
+		return node
+	}), nil
+}
+
+// 把求值的结果转换回 AST 节点，新节点的位置使用 unquote 调用的位置
+// 没有对应字面量的值（null、函数、超出 int64 的整数等）不能转换，返回错误
+func convertObjectToASTNode(obj Object, pos token.Position) (ast.Node, *Error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: fmt.Sprintf("%d", obj.Value),
+			Pos:     pos,
+		}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, nil
+	case *Float:
+		t := token.Token{
+			Type:    token.FLOAT,
+			Literal: obj.Inspect(),
+			Pos:     pos,
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}, nil
+	case *Boolean:
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+	case *String:
+		t := token.Token{
+			Type:    token.STRING,
+			Literal: obj.Value,
+			Pos:     pos,
+		}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+	case *Array:
+		array := &ast.ArrayLiteral{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos},
+			Elements: []ast.Expression{},
+		}
+		for _, element := range obj.Elements() {
+			exp, err := convertObjectToExpression(element, pos)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements = append(array.Elements, exp)
+		}
+		return array, nil
+	case *Hash:
+		hash := &ast.HashLiteral{
+			Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos},
+			Pairs: make(map[ast.Expression]ast.Expression),
+		}
+		for _, pair := range obj.Pairs() {
+			key, err := convertObjectToExpression(pair.Key, pos)
+			if err != nil {
+				return nil, err
+			}
+			value, err := convertObjectToExpression(pair.Value, pos)
+			if err != nil {
+				return nil, err
+			}
+			hash.Pairs[key] = value
+			hash.Keys = append(hash.Keys, key)
+		}
+		return hash, nil
+	case *Quote:
+		// 同一个 Quote 可能被替换进多个位置，每处使用各自的副本
+		return ast.Copy(obj.Node), nil
+	case nil:
+		return nil, newError("cannot unquote %s", NULL_OBJ)
+	default:
+		return nil, newError("cannot unquote %s", obj.Type())
+	}
+}
+
+// 数组和 hash 中的元素必须转换成表达式
+func convertObjectToExpression(obj Object, pos token.Position) (ast.Expression, *Error) {
+	node, err := convertObjectToASTNode(obj, pos)
+	if err != nil {
+		return nil, err
+	}
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		return nil, newError("cannot unquote %s", obj.Type())
+	}
+	return exp, nil
+}
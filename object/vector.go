@@ -0,0 +1,185 @@
+package object
+
+// 数组的存储：32 叉的前缀树加上一个尾部缓冲区（和 Clojure 的 PersistentVector 一样）
+// vector 是不可变的，push、set 返回新的 vector，和旧的共享没有改变的节点，都是 O(log32 n)
+// rest 只移动起始下标，是 O(1)；被丢掉的元素在数组变空之前不会被回收
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// 内部节点使用 children，叶子节点使用 values，一个节点最多有 vectorWidth 个
+type vectorNode struct {
+	children []*vectorNode
+	values   []Object
+}
+
+type vector struct {
+	root  *vectorNode
+	tail  []Object // 最后不满 vectorWidth 个的元素，不放到树里
+	shift uint     // 根节点所在的层，叶子节点是 0
+	count int      // 树和尾部的元素个数，包括 rest 丢掉的
+	start int      // rest 丢掉的元素个数
+}
+
+var emptyVector = vector{root: &vectorNode{}, shift: vectorBits}
+
+// 把切片分成叶子节点，再一层一层地建出整棵树
+func newVector(elements []Object) vector {
+	v := emptyVector
+	v.count = len(elements)
+	tailOffset := v.tailOffset()
+	v.tail = make([]Object, len(elements)-tailOffset)
+	copy(v.tail, elements[tailOffset:])
+
+	nodes := []*vectorNode{}
+	for i := 0; i < tailOffset; i += vectorWidth {
+		values := make([]Object, vectorWidth)
+		copy(values, elements[i:i+vectorWidth])
+		nodes = append(nodes, &vectorNode{values: values})
+	}
+	for len(nodes) > vectorWidth {
+		parents := []*vectorNode{}
+		for i := 0; i < len(nodes); i += vectorWidth {
+			end := i + vectorWidth
+			if end > len(nodes) {
+				end = len(nodes)
+			}
+			parents = append(parents, &vectorNode{children: nodes[i:end:end]})
+		}
+		nodes = parents
+		v.shift += vectorBits
+	}
+	v.root = &vectorNode{children: nodes}
+	return v
+}
+
+func (v vector) len() int {
+	return v.count - v.start
+}
+
+// 尾部第一个元素的下标
+func (v vector) tailOffset() int {
+	if v.count < vectorWidth {
+		return 0
+	}
+	return ((v.count - 1) >> vectorBits) << vectorBits
+}
+
+// 第 i 个元素所在的叶子，i 包括 rest 丢掉的元素
+func (v vector) leafFor(i int) []Object {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.values
+}
+
+func (v vector) get(i int) Object {
+	i += v.start
+	return v.leafFor(i)[i&vectorMask]
+}
+
+// 按顺序复制出所有的元素，每次复制一整个叶子
+func (v vector) slice() []Object {
+	result := make([]Object, 0, v.len())
+	tailOffset := v.tailOffset()
+	for i := v.start; i < tailOffset; {
+		leaf := v.leafFor(i)[i&vectorMask:]
+		result = append(result, leaf...)
+		i += len(leaf)
+	}
+	if v.start > tailOffset {
+		return append(result, v.tail[v.start-tailOffset:]...)
+	}
+	return append(result, v.tail...)
+}
+
+func (v vector) push(obj Object) vector {
+	// 尾部还有空间，只需要复制尾部
+	if v.count-v.tailOffset() < vectorWidth {
+		tail := make([]Object, len(v.tail)+1)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = obj
+		v.tail = tail
+		v.count++
+		return v
+	}
+
+	// 尾部满了，放到树里作为新的叶子
+	leaf := &vectorNode{values: v.tail}
+	if (v.count >> vectorBits) > (1 << v.shift) {
+		// 根节点也满了，树增加一层
+		v.root = &vectorNode{children: []*vectorNode{v.root, newVectorPath(v.shift, leaf)}}
+		v.shift += vectorBits
+	} else {
+		v.root = v.pushLeaf(v.shift, v.root, leaf)
+	}
+	v.tail = []Object{obj}
+	v.count++
+	return v
+}
+
+func (v vector) pushLeaf(level uint, parent *vectorNode, leaf *vectorNode) *vectorNode {
+	index := ((v.count - 1) >> level) & vectorMask
+	children := make([]*vectorNode, index+1)
+	copy(children, parent.children)
+	switch {
+	case level == vectorBits:
+		children[index] = leaf
+	case index < len(parent.children):
+		children[index] = v.pushLeaf(level-vectorBits, parent.children[index], leaf)
+	default:
+		children[index] = newVectorPath(level-vectorBits, leaf)
+	}
+	return &vectorNode{children: children}
+}
+
+// 从第 level 层到叶子只有一个分支的路径
+func newVectorPath(level uint, leaf *vectorNode) *vectorNode {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode{children: []*vectorNode{newVectorPath(level-vectorBits, leaf)}}
+}
+
+func (v vector) set(i int, obj Object) vector {
+	i += v.start
+	if i >= v.tailOffset() {
+		tail := make([]Object, len(v.tail))
+		copy(tail, v.tail)
+		tail[i-v.tailOffset()] = obj
+		v.tail = tail
+		return v
+	}
+	v.root = setVectorNode(v.shift, v.root, i, obj)
+	return v
+}
+
+func setVectorNode(level uint, node *vectorNode, i int, obj Object) *vectorNode {
+	if level == 0 {
+		values := make([]Object, len(node.values))
+		copy(values, node.values)
+		values[i&vectorMask] = obj
+		return &vectorNode{values: values}
+	}
+	children := make([]*vectorNode, len(node.children))
+	copy(children, node.children)
+	index := (i >> level) & vectorMask
+	children[index] = setVectorNode(level-vectorBits, node.children[index], i, obj)
+	return &vectorNode{children: children}
+}
+
+func (v vector) rest() vector {
+	if v.len() <= 1 {
+		// 数组空了，放掉之前的元素
+		return emptyVector
+	}
+	v.start++
+	return v
+}
@@ -0,0 +1,58 @@
+package object
+
+import "testing"
+
+// 和普通的切片对照，检查跨过叶子和层的边界时 push、rest、set 的结果
+func TestVector(t *testing.T) {
+	var model []Object
+	v := emptyVector
+	for i := 0; i < 1100; i++ {
+		obj := &Integer{Value: int64(i)}
+		before := v
+		v = v.push(obj)
+		model = append(model, obj)
+		if before.len() != i {
+			t.Fatalf("push changed the original vector. len=%d, want=%d", before.len(), i)
+		}
+		checkVector(t, v, model)
+	}
+
+	built := newVector(model)
+	checkVector(t, built, model)
+
+	replaced := &Integer{Value: -1}
+	for _, i := range []int{0, 31, 32, 1023, 1024, 1099} {
+		updated := built.set(i, replaced)
+		if updated.get(i) != replaced {
+			t.Errorf("set(%d) did not update the element", i)
+		}
+		if built.get(i) != model[i] {
+			t.Errorf("set(%d) changed the original vector", i)
+		}
+	}
+
+	rest := built
+	for i := 0; i < len(model); i++ {
+		rest = rest.rest()
+		checkVector(t, rest, model[i+1:])
+		if i%97 == 0 {
+			pushed := rest.push(replaced)
+			checkVector(t, pushed, append(model[i+1:len(model):len(model)], replaced))
+			checkVector(t, rest.set(0, replaced).rest(), model[i+2:])
+		}
+	}
+	checkVector(t, built, model)
+}
+
+func checkVector(t *testing.T, v vector, want []Object) {
+	t.Helper()
+	if v.len() != len(want) {
+		t.Fatalf("wrong length. got=%d, want=%d", v.len(), len(want))
+	}
+	elements := v.slice()
+	for i, obj := range want {
+		if v.get(i) != obj || elements[i] != obj {
+			t.Fatalf("wrong element %d. got=%s, want=%s", i, v.get(i).Inspect(), obj.Inspect())
+		}
+	}
+}
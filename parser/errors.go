@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// 语法错误，带有出错的位置、期望的词法单元以及实际遇到的词法单元
+type ParseError struct {
+	Pos      token.Position
+	Expected []token.TokenType // 期望的词法单元，没有明确期望时为空
+	Actual   token.Token       // 实际遇到的词法单元
+	Msg      string
+}
+
+func (e *ParseError) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+// 用于从出错的地方一直回退到最近的语句边界
+type bailout struct{}
+
+// 记录一个错误，但不中断解析，用于不影响后续结构的错误（例如数字越界）
+func (p *Parser) addError(tok token.Token, expected []token.TokenType, format string, args ...interface{}) {
+	p.errors = append(p.errors, &ParseError{
+		Pos:      tok.Pos,
+		Expected: expected,
+		Actual:   tok,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+// 记录一个错误并回退到语句边界，由 parseStatementRecover 进行恢复
+func (p *Parser) fail(tok token.Token, expected []token.TokenType, format string, args ...interface{}) {
+	p.addError(tok, expected, format, args...)
+	panic(bailout{})
+}
+
+// 解析一条语句，结束时 currentToken 是下一条语句的第一个词法单元
+// 语句中出现语法错误时，跳过剩余的词法单元，从下一个语句边界继续解析，
+// 这样一个错误不会引起一连串无意义的错误
+func (p *Parser) parseStatementRecover() (stmt ast.Statement) {
+	start := p.currentToken
+	// 语句开始之前的括号层数
+	depth := len(p.nesting)
+	if isOpening(start.Type) {
+		depth--
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			stmt = nil
+			p.synchronize(start, depth)
+		}
+	}()
+	stmt = p.parseStatement()
+	p.nextToken()
+	return stmt
+}
+
+// 跳过词法单元直到语句边界：越过 ;，或者停在 let、return、while、for 上，
+// 出错语句中还没有闭合的 {} 里的边界不算，整个跳过；
+// 遇到外层代码块的 } 时停下，交给外层的 parseBlockStatement 结束代码块
+// start 是出错语句的第一个词法单元，停在它上面会导致死循环，所以至少前进一次
+func (p *Parser) synchronize(start token.Token, depth int) {
+	for !p.currentTokenIs(token.EOF) {
+		moved := p.currentToken.Pos.Offset != start.Pos.Offset
+		switch p.currentToken.Type {
+		case token.SEMICOLON:
+			if p.atStatementLevel(depth) {
+				p.nextToken()
+				return
+			}
+		case token.LET, token.RETURN, token.WHILE, token.FOR:
+			if moved && p.atStatementLevel(depth) {
+				return
+			}
+		case token.RBRACE:
+			if len(p.nesting) < depth {
+				return
+			}
+		}
+		p.nextToken()
+	}
+}
+
+// 出错语句中没有闭合的只有 ( 和 [ 时，认为已经回到了语句这一层，丢掉这些括号
+func (p *Parser) atStatementLevel(depth int) bool {
+	if len(p.nesting) < depth {
+		return true
+	}
+	for _, t := range p.nesting[depth:] {
+		if t == token.LBRACE {
+			return false
+		}
+	}
+	p.nesting = p.nesting[:depth]
+	return true
+}
+
+// 记录括号的嵌套，} 同时闭合它里面没有闭合的 ( 和 [
+func (p *Parser) trackNesting(t token.TokenType) {
+	switch t {
+	case token.LBRACE, token.LPAREN, token.LBRACKET:
+		p.nesting = append(p.nesting, t)
+	case token.RPAREN, token.RBRACKET:
+		var opening token.TokenType = token.LPAREN
+		if t == token.RBRACKET {
+			opening = token.LBRACKET
+		}
+		if n := len(p.nesting); n > 0 && p.nesting[n-1] == opening {
+			p.nesting = p.nesting[:n-1]
+		}
+	case token.RBRACE:
+		for len(p.nesting) > 0 {
+			top := p.nesting[len(p.nesting)-1]
+			p.nesting = p.nesting[:len(p.nesting)-1]
+			if top == token.LBRACE {
+				break
+			}
+		}
+	}
+}
+
+func isOpening(t token.TokenType) bool {
+	return t == token.LBRACE || t == token.LPAREN || t == token.LBRACKET
+}
@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
@@ -12,7 +11,10 @@ type Parser struct {
 	l            *lexer.Lexer
 	currentToken token.Token
 	peekToken    token.Token
-	errors       []string
+	errors       []*ParseError
+	lexErrors    int // 已经转入 errors 的词法错误数量
+	loopDepth    int // 当前所在的循环层数，用于检查 break 和 continue
+	nesting      []token.TokenType // 到 currentToken 为止还没有闭合的 { ( [，用于错误恢复
 	// 用来检查遇到词法单元的时候，使用哪个解析函数
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
@@ -22,10 +24,13 @@ type Parser struct {
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = += -=
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // * / %
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
 	INDEX 		// array[index]
@@ -33,16 +38,27 @@ const (
 
 // 优先级对应表
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.PERCENT_ASSIGN:  ASSIGN,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.OR:              LOGICAL_OR,
+	token.AND:             LOGICAL_AND,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LT_EQ:           LESSGREATER,
+	token.GT_EQ:           LESSGREATER,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 // 优先级辅助函数
@@ -62,21 +78,25 @@ func (p *Parser) currentPrecedence() int {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -87,6 +107,17 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
@@ -96,19 +127,39 @@ func New(l *lexer.Lexer) *Parser {
 }
 
 // 错误处理
+// 以 file:line:col: msg 的形式返回所有错误
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Error()
+	}
+	return msgs
+}
+
+// 返回结构化的错误，可以拿到位置、期望和实际的词法单元
+func (p *Parser) ParseErrors() []*ParseError {
 	return p.errors
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.fail(p.peekToken, []token.TokenType{t},
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 // 和 lexer 中的nextToken相似
 func (p *Parser) nextToken() {
 	p.currentToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	p.trackNesting(p.currentToken.Type)
+	// 词法错误也作为语法分析的错误报告出来
+	for ; p.lexErrors < len(p.l.Errors()); p.lexErrors++ {
+		err := p.l.Errors()[p.lexErrors]
+		p.errors = append(p.errors, &ParseError{
+			Pos:    err.Pos,
+			Actual: p.peekToken,
+			Msg:    err.Msg,
+		})
+	}
 }
 
 // 主要方法
@@ -116,11 +167,10 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 	for !p.currentTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseStatementRecover()
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
-		p.nextToken()
 	}
 	return program
 }
@@ -132,6 +182,12 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
 
 	default:
 		return p.parseExpressionStatement()
@@ -156,6 +212,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// 记下函数的名字，用于编译递归调用和错误信息
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -178,6 +239,89 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// 解析 whileStatement
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// 解析 forStatement
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatement()
+}
+
+// 解析 break 和 continue
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.currentToken
+	if p.loopDepth == 0 {
+		p.fail(tok, nil, "%s outside loop", tok.Literal)
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
 // 解析 expressionStatement
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	// untrace(trace("parseExpressionStatement"))
@@ -212,8 +356,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.fail(p.currentToken, nil, "no prefix parse function for %s found", t)
 }
 
 // 工具函数，用于比较currentToken Type是否与传入的tokenType相同
@@ -267,6 +410,11 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	}
 }
 
+// 非法的词法单元已经由词法分析器报告过错误，这里直接跳过
+func (p *Parser) parseIllegal() ast.Expression {
+	return nil
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	// untrace(trace("parseIntegerLiteral"))
 	il := &ast.IntegerLiteral{
@@ -274,14 +422,26 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	}
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.currentToken, nil, "could not parse %q as integer", p.currentToken.Literal)
 		return nil
 	}
 	il.Value = value
 	return il
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	fl := &ast.FloatLiteral{
+		Token: p.currentToken,
+	}
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		p.addError(p.currentToken, nil, "could not parse %q as float", p.currentToken.Literal)
+		return nil
+	}
+	fl.Value = value
+	return fl
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	// untrace(trace("parsePrefixExpression"))
 	pe := &ast.PrefixExpression{
@@ -306,6 +466,23 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// 赋值是右结合的，a = b = 1 等价于 a = (b = 1)
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.currentToken,
+		Operator: p.currentToken.Literal,
+		Target:   target,
+	}
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.fail(p.currentToken, nil, "invalid assignment target %s", target.String())
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	// untrace(trace("parseBoolean"))
 	return &ast.Boolean{
@@ -351,6 +528,49 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return ie
 }
 
+func (p *Parser) parseTryExpression() ast.Expression {
+	te := &ast.TryExpression{
+		Token: p.currentToken,
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	te.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			te.CatchParameter = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		te.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		te.Finally = p.parseBlockStatement()
+	}
+
+	if te.Catch == nil && te.Finally == nil {
+		p.nextToken()
+		p.fail(p.currentToken, []token.TokenType{token.CATCH, token.FINALLY},
+			"expected catch or finally after try block, got %s instead", p.currentToken.Type)
+	}
+	return te
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{
 		Token: p.currentToken,
@@ -358,11 +578,14 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block.Statements = []ast.Statement{}
 	p.nextToken()
 	for !p.currentTokenIs(token.RBRACE) && !p.currentTokenIs(token.EOF) {
-		stmt := p.parseStatement()
+		stmt := p.parseStatementRecover()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
-		p.nextToken()
+	}
+	if !p.currentTokenIs(token.RBRACE) {
+		p.fail(p.currentToken, []token.TokenType{token.RBRACE},
+			"expected %s to close block, got %s instead", token.RBRACE, p.currentToken.Type)
 	}
 	return block
 }
@@ -378,10 +601,29 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	// 函数体中不能 break 外层的循环
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = loopDepth }()
 	fl.Body = p.parseBlockStatement()
 	return fl
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	ml := &ast.MacroLiteral{
+		Token: p.currentToken,
+	}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	ml.Parameters = p.parseFunctionParameters()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	ml.Body = p.parseBlockStatement()
+	return ml
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 	if p.peekTokenIs(token.RPAREN) {
@@ -507,6 +749,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) { 
 			return nil 
 		}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/token"
 	"testing"
 )
 
@@ -141,6 +142,33 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	input := "3.14;"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	literal, ok := stmt.Expression.(*ast.FloatLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != 3.14 {
+		t.Errorf("literal.Value not %f. got=%f", 3.14, literal.Value)
+	}
+	if literal.TokenLiteral() != "3.14" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "3.14", literal.TokenLiteral())
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input        string
@@ -208,6 +236,11 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 && 5;", 5, "&&", 5},
+		{"5 || 5;", 5, "||", 5},
 	}
 	for _, tt := range infixTests {
 		l := lexer.New(tt.input)
@@ -310,6 +343,38 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])", 
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))", 
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a > 0 && b > 0",
+			"((a > 0) && (b > 0))",
+		},
+		{
+			"a || b && c || d",
+			"((a || (b && c)) || d)",
+		},
+		{
+			"!a && b == c || d",
+			"(((!a) && (b == c)) || d)",
+		},
+		{
+			"a = b = c + 1",
+			"(a = (b = (c + 1)))",
+		},
+		{
+			"a += b * 2",
+			"(a += (b * 2))",
+		},
+		{
+			"a[i] = x || y",
+			"((a[i]) = (x || y))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -584,6 +649,53 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -793,4 +905,355 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		} 
 		testFunc(value) 
 	} 
-}
\ No newline at end of file
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = (1 + 2;", "1:15: expected next token to be ), got ; instead"},
+		{"let x = 1;\nlet = 2;", "2:5: expected next token to be IDENT, got = instead"},
+		{"\n  );", "2:3: no prefix parse function for ) found"},
+		{`let s = "abc`, "1:9: unterminated string literal"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+
+func TestParserErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements int
+	}{
+		{
+			"let x = (1 + 2; let y = 3; y;",
+			[]string{"1:15: expected next token to be ), got ; instead"},
+			2,
+		},
+		{
+			"let = 1;\nlet y = 2;\nreturn y",
+			[]string{"1:5: expected next token to be IDENT, got = instead"},
+			2,
+		},
+		{
+			"let x = 5 +\nlet y = 2;",
+			[]string{"2:1: no prefix parse function for LET found"},
+			1,
+		},
+		{
+			"let f = fn(x) { x + ; };\nlet g = fn(y) { let = y };\nf(1);",
+			[]string{
+				"1:21: no prefix parse function for ; found",
+				"2:21: expected next token to be IDENT, got = instead",
+			},
+			3,
+		},
+		{
+			"add(1, 2; let x = ); let y = 1;",
+			[]string{
+				"1:9: expected next token to be ), got ; instead",
+				"1:19: no prefix parse function for ) found",
+			},
+			1,
+		},
+		{
+			"} let x = 1;",
+			[]string{"1:1: no prefix parse function for } found"},
+			1,
+		},
+		{
+			"let f = fn() { 1",
+			[]string{"1:17: expected } to close block, got EOF instead"},
+			0,
+		},
+		// 跳过出错语句中成对的括号，不会在 else 和 } 上再报错
+		{
+			"fn(x) { if (x > 1 { x } else { 0 } }; let y = 1;",
+			[]string{"1:19: expected next token to be ), got { instead"},
+			2,
+		},
+		{
+			"let f = fn(x) { if (x > 1 { let y = x; y } else { 0 } };\nf(1);",
+			[]string{"1:27: expected next token to be ), got { instead"},
+			2,
+		},
+		{
+			`{"a": 1 "b": 2}; let y = 1;`,
+			[]string{"1:9: expected next token to be ,, got STRING instead"},
+			1,
+		},
+		{
+			"fn(x) { x + }; let y = 1;",
+			[]string{"1:13: no prefix parse function for } found"},
+			2,
+		},
+		{
+			"let a = [1, (2 + 3]; let b = 2;",
+			[]string{"1:19: expected next token to be ), got ] instead"},
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("wrong number of errors for %q. expected=%q, got=%q",
+				tt.input, tt.expectedErrors, errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i] != msg {
+				t.Errorf("wrong error. expected=%q, got=%q", msg, errors[i])
+			}
+		}
+		if len(program.Statements) != tt.expectedStatements {
+			t.Errorf("wrong number of statements for %q. expected=%d, got=%d (%s)",
+				tt.input, tt.expectedStatements, len(program.Statements), program)
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		target   string
+		value    string
+	}{
+		{"x = 5;", "=", "x", "5"},
+		{"x += 1;", "+=", "x", "1"},
+		{"x -= y;", "-=", "x", "y"},
+		{"x *= 2;", "*=", "x", "2"},
+		{"x /= 2;", "/=", "x", "2"},
+		{"x %= 2;", "%=", "x", "2"},
+		{`h["k"] = 1;`, "=", "(h[k])", "1"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.AssignExpression. got=%T", stmt.Expression)
+		}
+		if exp.Operator != tt.operator {
+			t.Errorf("exp.Operator is not %q. got=%q", tt.operator, exp.Operator)
+		}
+		if exp.Target.String() != tt.target {
+			t.Errorf("exp.Target is not %q. got=%q", tt.target, exp.Target.String())
+		}
+		if exp.Value.String() != tt.value {
+			t.Errorf("exp.Value is not %q. got=%q", tt.value, exp.Value.String())
+		}
+	}
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2;", "1:3: invalid assignment target 1"},
+		{"f() = 2;", "1:5: invalid assignment target f()"},
+		{"a + b = 2;", "1:7: invalid assignment target (a + b)"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 error for %q. got=%v", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x += 1; continue; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body does not contain 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[1] is not *ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (item in [1, 2]) { if (item > 1) { break; } item }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.ForStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "item") {
+		return
+	}
+	if stmt.Iterable.String() != "[1, 2]" {
+		t.Errorf("stmt.Iterable is not %q. got=%q", "[1, 2]", stmt.Iterable.String())
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body does not contain 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if stmt.String() != "for(item in [1, 2]) if(item > 1) break;item" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestLoopTrailingSemicolon(t *testing.T) {
+	tests := []string{
+		"while (x) { x }; puts(x)",
+		"for (x in y) { x }; puts(x)",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 2 {
+			t.Errorf("%q: program.Statements does not contain 2 statements. got=%d",
+				input, len(program.Statements))
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"break;", []string{"1:1: break outside loop"}},
+		{"if (true) { continue; }", []string{"1:13: continue outside loop"}},
+		{"while (true) { fn() { break; }; break; }", []string{"1:23: break outside loop"}},
+		{"for (x in y) { break; continue; }", []string{}},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q. want=%v, got=%v", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("wrong error. want=%q, got=%q", msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []struct {
+		input     string
+		parameter string
+		hasCatch  bool
+		expected  string
+	}{
+		{"try { x } catch (e) { y }", "e", true, "try x catch (e) y"},
+		{"try { x } catch { y } finally { z }", "", true, "try x catch y finally z"},
+		{"try { x } finally { z }", "", false, "try x finally z"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		te, ok := stmt.Expression.(*ast.TryExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not *ast.TryExpression. got=%T", stmt.Expression)
+		}
+		if (te.Catch != nil) != tt.hasCatch {
+			t.Errorf("%q: wrong catch block. got=%v", tt.input, te.Catch)
+		}
+		if tt.parameter != "" && (te.CatchParameter == nil || te.CatchParameter.Value != tt.parameter) {
+			t.Errorf("%q: wrong catch parameter. got=%v", tt.input, te.CatchParameter)
+		}
+		if te.String() != tt.expected {
+			t.Errorf("%q: wrong String(). got=%q", tt.input, te.String())
+		}
+	}
+
+	l := lexer.New("try { x } 1")
+	p := New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) != 1 || errors[0] != "1:11: expected catch or finally after try block, got INT instead" {
+		t.Errorf("wrong errors. got=%v", errors)
+	}
+}
+
+func TestParseErrorDetails(t *testing.T) {
+	l := lexer.New("let x = (1 + 2;")
+	p := New(l)
+	p.ParseProgram()
+	errors := p.ParseErrors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error. got=%d", len(errors))
+	}
+	err := errors[0]
+	if err.Pos.Line != 1 || err.Pos.Column != 15 {
+		t.Errorf("wrong position. got=%s", err.Pos)
+	}
+	if len(err.Expected) != 1 || err.Expected[0] != token.RPAREN {
+		t.Errorf("wrong expected tokens. got=%v", err.Expected)
+	}
+	if err.Actual.Type != token.SEMICOLON {
+		t.Errorf("wrong actual token. got=%s", err.Actual.Type)
+	}
+	if err.Msg != "expected next token to be ), got ; instead" {
+		t.Errorf("wrong message. got=%q", err.Msg)
+	}
+}
@@ -6,18 +6,29 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/compiler"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/vm"
+	"os"
 	// "monkey/token"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
+// 执行引擎：树遍历求值器或者字节码虚拟机
+const (
+	ENGINE_EVAL = "eval"
+	ENGINE_VM   = "vm"
+)
+
+func Start(in io.Reader, out io.Writer, engine string) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	macroEnv := object.NewEnvironment()
+	run := newRunner(engine)
 	for {
 		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
@@ -32,8 +43,17 @@ func Start(in io.Reader, out io.Writer) {
 			printParserErrors(out, p.Errors())
 			continue
 		}
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil { 
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			io.WriteString(out, err.Error()+"\n")
+			continue
+		}
+		evaluated := run(expanded)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, errObj.Traceback())
+			io.WriteString(out, "\n")
+		} else if evaluated != nil { 
 			io.WriteString(out, evaluated.Inspect()) 
 			io.WriteString(out, "\n") 
 		}
@@ -41,7 +61,71 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
+// 返回一个执行函数，多次调用之间保留变量等状态
+func newRunner(engine string) func(node ast.Node) object.Object {
+	if engine == ENGINE_VM {
+		constants := []object.Object{}
+		globals := make([]object.Object, vm.GlobalsSize)
+		symbolTable := compiler.NewSymbolTable()
+		for i, v := range object.Builtins {
+			symbolTable.DefineBuiltin(i, v.Name)
+		}
+		return func(node ast.Node) object.Object {
+			comp := compiler.NewWithState(symbolTable, constants)
+			err := comp.Compile(node)
+			if err != nil {
+				return &object.Error{Message: err.Error()}
+			}
+			bytecode := comp.Bytecode()
+			constants = bytecode.Constants
 
+			machine := vm.NewWithGlobalsStore(bytecode, globals)
+			// 运行时的错误已经带有位置和调用栈
+			err = machine.Run()
+			if err != nil {
+				return err.(*object.Error)
+			}
+			return machine.LastPoppedStackElem()
+		}
+	}
+
+	env := object.NewEnvironment()
+	return func(node ast.Node) object.Object {
+		return evaluator.Eval(node, env)
+	}
+}
+
+// 执行一个脚本文件，出错时返回 false
+func RunFile(filename string, out io.Writer, engine string) bool {
+	input, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+	l := lexer.NewFile(filename, string(input))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			io.WriteString(out, msg+"\n")
+		}
+		return false
+	}
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, err := evaluator.ExpandMacros(program, macroEnv)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+	evaluated := newRunner(engine)(expanded)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		io.WriteString(out, errObj.Traceback())
+		io.WriteString(out, "\n")
+		return false
+	}
+	return true
+}
 
 
 const MONKEY_FACE = `
@@ -4,17 +4,20 @@
 
 package token
 
+import "fmt"
 
 
 const (
 	EOF = "EOF"
 	ILLEGAL = "ILLEGAL"
+	COMMENT = "COMMENT" // 只有词法分析器设置了 ScanComments 时才会产生
 
 	// 标识符
 	IDENT = "IDENT"  //变量名等等
 
 	// 字面量
 	INT = "INT" // 123  321
+	FLOAT = "FLOAT" // 3.14  1e-9
 
 	// 运算符
 	ASSIGN = "=" 
@@ -23,13 +26,25 @@ const (
 	BANG = "!" 
 	ASTERISK = "*" 
 	SLASH = "/"
+	PERCENT = "%"
+
+	PLUS_ASSIGN = "+="
+	MINUS_ASSIGN = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN = "/="
+	PERCENT_ASSIGN = "%="
 
 	LT = "<" 
 	GT = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ = "=="
 	NOT_EQ = "!="
 
+	AND = "&&"
+	OR = "||"
+
 	// 分隔符
 	COMMA = ","
 	SEMICOLON = ";"
@@ -51,6 +66,15 @@ const (
 	ELSE = "ELSE"
 	RETURN = "RETURN"
 	STRING = "STRING"
+	MACRO = "MACRO"
+	WHILE = "WHILE"
+	FOR = "FOR"
+	IN = "IN"
+	BREAK = "BREAK"
+	CONTINUE = "CONTINUE"
+	TRY = "TRY"
+	CATCH = "CATCH"
+	FINALLY = "FINALLY"
 
 )
 
@@ -62,13 +86,43 @@ type TokenType string
 type Token struct {
 	Type TokenType
 	Literal string
+	Pos Position // 词法单元第一个字符所在的位置
+}
+
+
+// 源码中的位置，Line 和 Column 都从 1 开始，Offset 是从 0 开始的字节偏移
+type Position struct {
+	Filename string
+	Offset int
+	Line int
+	Column int
+}
+
+// 行号大于 0 时位置才有效
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// 以 file:line:col 的形式输出，没有文件名时为 line:col
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
 }
 
 
-func NewToken(t TokenType, b byte) *Token {
+func NewToken(t TokenType, ch rune) *Token {
 	return &Token{
 		Type: t,
-		Literal: string(b),
+		Literal: string(ch),
 	}
 }
 
@@ -82,6 +136,15 @@ var keywords = map[string]TokenType {
 	"if": IF,
 	"else": ELSE,
 	"return": RETURN,
+	"macro": MACRO,
+	"while": WHILE,
+	"for": FOR,
+	"in": IN,
+	"break": BREAK,
+	"continue": CONTINUE,
+	"try": TRY,
+	"catch": CATCH,
+	"finally": FINALLY,
 }
 
 // 查找是否在keyword中，以判断是否是关键字还是标识符
@@ -0,0 +1,14 @@
+package vm
+
+import "monkey/object"
+
+const CELL_OBJ = "CELL"
+
+// 被闭包捕获并且会被赋值的变量保存在 cell 中，外层函数和闭包共享同一个 cell
+// 只在虚拟机内部使用，读取变量时总是取出其中的值，不会被 Monkey 程序看到
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return CELL_OBJ }
+func (c *cell) Inspect() string         { return "cell(" + c.value.Inspect() + ")" }
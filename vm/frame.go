@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+// 调用栈中的一帧
+type Frame struct {
+	cl          *object.Closure
+	ip          int // 当前执行到的指令
+	basePointer int // 调用前的栈顶，局部变量从这里开始存放
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	f := &Frame{
+		cl:          cl,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+
+	return f
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// 当前执行的指令在源码中的位置
+func (f *Frame) position() token.Position {
+	return f.cl.Fn.SourceMap.Lookup(f.ip)
+}
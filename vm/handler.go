@@ -0,0 +1,30 @@
+package vm
+
+import "monkey/object"
+
+// OpTry 记录的 try 块：出错时回到它所在的栈帧和栈的高度，从 catchPos 继续执行
+type handler struct {
+	catchPos    int
+	framesIndex int
+	sp          int
+}
+
+// 最内层的 try 块是否在第 base 个栈帧之上，内置函数回调中只能捕获回调中的错误
+func (vm *VM) canCatch(base int) bool {
+	return len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > base
+}
+
+// 弹出最内层的 try 块，把错误对象压栈后跳转到它的 catch
+// 不在 try 块中时返回 false，错误继续向外传递
+func (vm *VM) catch(errObj *object.Error) bool {
+	if len(vm.handlers) == 0 {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.framesIndex = h.framesIndex
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.catchPos - 1
+	return vm.push(errObj) == nil
+}
@@ -0,0 +1,39 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/object"
+)
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// for 循环使用的迭代器，只在虚拟机内部使用，不会被 Monkey 程序看到
+type iterator struct {
+	items []object.Object
+	index int
+}
+
+func (it *iterator) Type() object.ObjectType { return ITERATOR_OBJ }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+// 和求值器一样，遍历数组的元素、hash 的键以及字符串中的字符
+func newIterator(iterable object.Object) (*iterator, error) {
+	var items []object.Object
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		items = iterable.Elements()
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			items = append(items, pair.Key)
+		}
+	case *object.String:
+		for _, r := range iterable.Value {
+			items = append(items, &object.String{Value: string(r)})
+		}
+	default:
+		return nil, fmt.Errorf("cannot iterate over %s", iterable.Type())
+	}
+
+	return &iterator{items: items}, nil
+}
@@ -0,0 +1,914 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+// 和求值器一样，布尔值和 null 只有一个实例
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
+
+type VM struct {
+	constants []object.Object
+
+	stack []object.Object
+	sp    int // 总是指向栈顶的下一个空位，栈顶元素是 stack[sp-1]
+
+	globals     []object.Object
+	globalNames []string // 全局变量的名字，报告没有赋值的全局变量时使用
+
+	frames      []*Frame
+	framesIndex int
+
+	handlers []handler // 当前所在的 try 块，最内层的在最后
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.GlobalNames,
+
+		frames:      frames,
+		framesIndex: 1,
+	}
+}
+
+// 沿用之前的全局变量，REPL 中使用
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+// 最后一个被弹出栈的元素，也就是最后一个表达式语句的值
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// 执行字节码，出错时如果在 try 块中，从对应的 catch 继续执行
+// 返回的错误总是 *object.Error，带有出错的位置和调用栈
+func (vm *VM) Run() error {
+	for {
+		err := vm.run(0)
+		if err == nil {
+			return nil
+		}
+		errObj := vm.newError(err)
+		if !vm.catch(errObj) {
+			return errObj
+		}
+	}
+}
+
+// 把执行中的错误转换为 *object.Error，还没有位置和调用栈时，补上当前指令的位置和当前的调用栈
+// 需要在 catch 展开栈帧之前调用，内层已经设置过的不会被覆盖
+func (vm *VM) newError(err error) *object.Error {
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		errObj = &object.Error{Message: err.Error()}
+	}
+	if !errObj.Pos.IsValid() {
+		errObj.Pos = vm.currentFrame().position()
+	}
+	if errObj.Stack == nil {
+		errObj.Stack = vm.callStack()
+	}
+	return errObj
+}
+
+// 和求值器一样的调用栈，每个栈帧的调用位置是上一帧当前执行的指令，顶层时为 nil
+func (vm *VM) callStack() *object.Frame {
+	var stack *object.Frame
+	for i := 1; i < vm.framesIndex; i++ {
+		name := vm.frames[i].cl.Fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		stack = &object.Frame{
+			Name:    name,
+			CallPos: vm.frames[i-1].position(),
+			Caller:  stack,
+			Depth:   i,
+		}
+	}
+	return stack
+}
+
+func (vm *VM) undefinedGlobal(index uint16) error {
+	return fmt.Errorf("identifier not found: %s", vm.globalNames[index])
+}
+
+// 执行字节码的主循环，栈帧数回到 stopAt 时返回，内置函数回调函数时使用
+func (vm *VM) run(stopAt int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > stopAt && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.push(vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpEqual, code.OpNotEqual,
+			code.OpGreaterThan, code.OpGreaterThanOrEqual,
+			code.OpLessThan, code.OpLessThanOrEqual:
+			err := vm.executeBinaryOperation(op)
+			if err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			err := vm.push(True)
+			if err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			err := vm.push(False)
+			if err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			err := vm.executeBangOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			err := vm.executeMinusOperator()
+			if err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpNull:
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpAssignGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if vm.globals[globalIndex] == nil {
+				return vm.undefinedGlobal(globalIndex)
+			}
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			// 变量在编译时已经定义，但执行到这里时还没有赋值
+			value := vm.globals[globalIndex]
+			if value == nil {
+				return vm.undefinedGlobal(globalIndex)
+			}
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+
+			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			definition := object.Builtins[builtinIndex]
+
+			err := vm.push(definition.Builtin)
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure.Free[freeIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpBox:
+			err := vm.push(&cell{value: vm.pop()})
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetCell:
+			err := vm.push(vm.pop().(*cell).value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetCell:
+			c := vm.pop().(*cell)
+			c.value = vm.pop()
+
+		case code.OpCurrentClosure:
+			currentClosure := vm.currentFrame().cl
+			err := vm.push(currentClosure)
+			if err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err := vm.push(array)
+			if err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(hash)
+			if err != nil {
+				return err
+			}
+
+		case code.OpHashKey:
+			key := vm.stack[vm.sp-1]
+			if !object.IsHashable(key) {
+				return fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIndexKeep:
+			index := vm.stack[vm.sp-1]
+			left := vm.stack[vm.sp-2]
+
+			err := vm.executeIndexExpression(left, index)
+			if err != nil {
+				return err
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSetIndex(left, index, value)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIterInit:
+			iterable := vm.pop()
+
+			iter, err := newIterator(iterable)
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(iter)
+			if err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			iter := vm.pop().(*iterator)
+			if iter.index >= len(iter.items) {
+				vm.currentFrame().ip = pos - 1
+				continue
+			}
+
+			item := iter.items[iter.index]
+			iter.index++
+
+			err := vm.push(item)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err := vm.executeCall(int(numArgs))
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// 顶层的 return 结束整个程序
+			if vm.framesIndex == 1 {
+				vm.stack[vm.sp] = returnValue
+				return nil
+			}
+
+			frame := vm.popFrame()
+			// 同时弹出被调用的函数本身
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(returnValue)
+			if err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			err := vm.push(Null)
+			if err != nil {
+				return err
+			}
+
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{
+				catchPos:    pos,
+				framesIndex: vm.framesIndex,
+				sp:          vm.sp,
+			})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpCatch:
+			errObj := vm.pop().(*object.Error)
+			err := vm.push(errObj.Hash())
+			if err != nil {
+				return err
+			}
+
+		case code.OpThrow:
+			return vm.pop().(*object.Error)
+
+		case code.OpUndefined:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			name := vm.constants[constIndex].(*object.String).Value
+			return fmt.Errorf("identifier not found: %s", name)
+
+		case code.OpQuote:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numValues := int(code.ReadUint16(ins[ip+3:]))
+			vm.currentFrame().ip += 4
+
+			quote := vm.constants[constIndex].(*object.Quote)
+			values := make([]object.Object, numValues)
+			copy(values, vm.stack[vm.sp-numValues:vm.sp])
+			vm.sp = vm.sp - numValues
+
+			node, errObj := object.Unquote(quote.Node, values)
+			if errObj != nil {
+				return errObj
+			}
+			err := vm.push(&object.Quote{Node: node})
+			if err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err := vm.pushClosure(int(constIndex), int(numFree))
+			if err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhandled opcode %s", def.Name)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+var operatorSymbols = map[code.Opcode]string{
+	code.OpAdd:                "+",
+	code.OpSub:                "-",
+	code.OpMul:                "*",
+	code.OpDiv:                "/",
+	code.OpMod:                "%",
+	code.OpEqual:              "==",
+	code.OpNotEqual:           "!=",
+	code.OpGreaterThan:        ">",
+	code.OpGreaterThanOrEqual: ">=",
+	code.OpLessThan:           "<",
+	code.OpLessThanOrEqual:    "<=",
+}
+
+// 二元运算，类型的判断顺序和错误信息与求值器中的 evalInfixExpression 保持一致
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	leftType := left.Type()
+	rightType := right.Type()
+	operator := operatorSymbols[op]
+
+	switch {
+	case object.IsInteger(left) && object.IsInteger(right):
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return vm.executeBinaryStringOperation(op, left, right)
+	case op == code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(object.Equals(left, right)))
+	case op == code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(!object.Equals(left, right)))
+	case leftType != rightType:
+		return fmt.Errorf("type mismatch: %s %s %s", leftType, operator, rightType)
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", leftType, operator, rightType)
+	}
+}
+
+// 算术运算的除零和溢出由 object.IntegerArithmetic 处理
+func (vm *VM) executeBinaryIntegerOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	switch op {
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod:
+		result := object.IntegerArithmetic(operatorSymbols[op], left, right)
+		if errObj, ok := result.(*object.Error); ok {
+			return fmt.Errorf("%s", errObj.Message)
+		}
+		return vm.push(result)
+	}
+
+	cmp := object.CompareIntegers(left, right)
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp == 0))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp != 0))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(cmp > 0))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp >= 0))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(cmp < 0))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(cmp <= 0))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryFloatOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.Float{Value: leftValue + rightValue})
+	case code.OpSub:
+		return vm.push(&object.Float{Value: leftValue - rightValue})
+	case code.OpMul:
+		return vm.push(&object.Float{Value: leftValue * rightValue})
+	case code.OpDiv:
+		return vm.push(&object.Float{Value: leftValue / rightValue})
+	case code.OpMod:
+		return vm.push(&object.Float{Value: math.Mod(leftValue, rightValue)})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBinaryStringOperation(
+	op code.Opcode,
+	left, right object.Object,
+) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return vm.push(&object.String{Value: leftValue + rightValue})
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpGreaterThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
+	case code.OpLessThanOrEqual:
+		return vm.push(nativeBoolToBooleanObject(leftValue <= rightValue))
+	default:
+		return fmt.Errorf("unknown operator: %s %s %s", left.Type(), operatorSymbols[op], right.Type())
+	}
+}
+
+func (vm *VM) executeBangOperator() error {
+	operand := vm.pop()
+
+	switch operand {
+	case True:
+		return vm.push(False)
+	case False:
+		return vm.push(True)
+	case Null:
+		return vm.push(True)
+	default:
+		return vm.push(False)
+	}
+}
+
+func (vm *VM) executeMinusOperator() error {
+	operand := vm.pop()
+
+	switch operand := operand.(type) {
+	case *object.Integer, *object.BigInt:
+		result := object.NegateInteger(operand)
+		if errObj, ok := result.(*object.Error); ok {
+			return fmt.Errorf("%s", errObj.Message)
+		}
+		return vm.push(result)
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
+	default:
+		return fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return object.NewArray(elements)
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hash := &object.Hash{}
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		if !object.IsHashable(key) {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hash.Set(key, value)
+	}
+
+	return hash, nil
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return vm.executeHashIndex(left, index)
+	default:
+		return fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+func (vm *VM) executeArrayIndex(array, index object.Object) error {
+	arrayObject := array.(*object.Array)
+	i := index.(*object.Integer).Value
+	max := int64(arrayObject.Len() - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(arrayObject.At(int(i)))
+}
+
+func (vm *VM) executeHashIndex(hash, index object.Object) error {
+	hashObject := hash.(*object.Hash)
+
+	if !object.IsHashable(index) {
+		return fmt.Errorf("unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := hashObject.Get(index)
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(value)
+}
+
+// 直接修改数组或者 hash 中的元素
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		arrayObject := left.(*object.Array)
+		i := index.(*object.Integer).Value
+		if arrayObject.Frozen {
+			return fmt.Errorf("cannot modify %s used as hash key", left.Type())
+		}
+		if i < 0 || i >= int64(arrayObject.Len()) {
+			return fmt.Errorf("index out of range: %d", i)
+		}
+		arrayObject.Set(int(i), value)
+	case left.Type() == object.HASH_OBJ:
+		hashObject := left.(*object.Hash)
+		if hashObject.Frozen {
+			return fmt.Errorf("cannot modify %s used as hash key", left.Type())
+		}
+		if !object.IsHashable(index) {
+			return fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		hashObject.Set(index, value)
+	default:
+		return fmt.Errorf("index assignment not supported: %s", left.Type())
+	}
+
+	return vm.push(value)
+}
+
+// 被调用的函数在栈上，位于参数之前
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	// 为局部变量预留空间，栈不够时在调用处报错
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+// 内置函数返回的错误会终止执行，和求值器一致
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Call(vm.callFunction, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if errObj, ok := result.(*object.Error); ok {
+		return errObj
+	}
+	if result != nil {
+		return vm.push(result)
+	}
+	return vm.push(Null)
+}
+
+// 供内置函数回调：在当前的栈上调用函数，一直执行到它返回
+// 回调中的 try 块可以捕获回调中的错误，其他错误作为 *object.Error 返回给内置函数
+func (vm *VM) callFunction(fn object.Object, args ...object.Object) object.Object {
+	base := vm.framesIndex
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err == nil {
+			err = vm.push(arg)
+		}
+	}
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	for err == nil && vm.framesIndex > base {
+		err = vm.run(base)
+		if err != nil {
+			errObj := vm.newError(err)
+			if vm.canCatch(base) && vm.catch(errObj) {
+				err = nil
+			} else {
+				err = errObj
+			}
+		}
+	}
+	if err != nil {
+		return vm.newError(err)
+	}
+	return vm.pop()
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i]
+	}
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	return vm.push(closure)
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func isNumber(obj object.Object) bool {
+	return object.IsInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+func toFloat(obj object.Object) float64 {
+	if f, ok := obj.(*object.Float); ok {
+		return f.Value
+	}
+	return object.IntegerToFloat(obj)
+}
@@ -0,0 +1,703 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/internal/enginetest"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"4 / 2", 2},
+		{"7 % 3", 1},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1.5", 1.5},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"7 / 2.0", 3.5},
+		{"5.5 % 2", 1.5},
+		{"-2.5", -2.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 <= 1", true},
+		{"2 >= 3", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1.5 < 2", true},
+		{"1 == 1.0", true},
+		{"true == true", true},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"!true", false},
+		{"!5", false},
+		{"!!5", true},
+		{"!(if (false) { 5; })", true},
+		{"true && false", false},
+		{"1 && 2", true},
+		{"false || 0", true},
+		{"false || false", false},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"apple" < "banana"`, true},
+		{`"b" > "abc"`, true},
+		{`"a" <= "a"`, true},
+		{`"a" >= "b"`, false},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, [2, 3]] == [1, [2, 4]]", false},
+		{"[1, 2] != [1, 2, 3]", true},
+		{"[1] == [1.0]", true},
+		{`{"a": [1], "b": 2} == {"b": 2, "a": [1]}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`"1" == 1`, false},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalShortCircuit(t *testing.T) {
+	enginetest.Run(t, enginetest.LogicalShortCircuit, testRun)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 1; }", Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let a = 1; let a = a + 1; a", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = 5; a = 10; a;", 10},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let a = 5; a += 2; a;", 7},
+		{"let a = 5; a %= 2; a;", 1},
+		{"let a = 1; let f = fn() { a = 2; }; f(); a;", 2},
+		{"let f = fn(x) { let y = 1; y += x; x *= 2; x + y }; f(3);", 10},
+		{"let a = [1, 2, 3]; a[0] = 10; a;", []int{10, 2, 3}},
+		{"let a = [1, 2, 3]; a[1] += 5; a[1];", 7},
+		{`let h = {"a": 1}; h["a"] *= 10; h["b"] = 2; h["a"] + h["b"];`, 12},
+	}
+
+	runVmTests(t, tests)
+
+	enginetest.Run(t, enginetest.AssignErrors, testRun)
+}
+
+func TestLoops(t *testing.T) {
+	enginetest.Run(t, enginetest.Loops, testRun)
+}
+
+func TestTryCatch(t *testing.T) {
+	enginetest.Run(t, enginetest.TryCatch, testRun)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			"{}", map[object.HashKey]int64{},
+		},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 1}).HashKey(): 2,
+				(&object.Integer{Value: 2}).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				(&object.Integer{Value: 2}).HashKey(): 4,
+				(&object.Integer{Value: 6}).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashOrder(t *testing.T) {
+	enginetest.Run(t, enginetest.HashOrder, testRun)
+}
+
+func TestCompositeHashKeys(t *testing.T) {
+	enginetest.Run(t, enginetest.CompositeHashKeys, testRun)
+}
+
+func TestHashBuiltins(t *testing.T) {
+	enginetest.Run(t, enginetest.HashBuiltins, testRun)
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	enginetest.Run(t, enginetest.CollectionBuiltins, testRun)
+}
+
+func TestArrayValueSemantics(t *testing.T) {
+	enginetest.Run(t, enginetest.ArrayValueSemantics, testRun)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`{"one": 1}["one"]`, 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let fivePlusTen = fn() { 5 + 10; }; fivePlusTen();", 15},
+		{"let a = fn() { 1 }; let b = fn() { a() + 1 }; b();", 2},
+		{"let earlyExit = fn() { return 99; 100; }; earlyExit();", 99},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let identity = fn(a) { a; }; identity(4);", 4},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2);", 3},
+		{
+			`let globalSeed = 50;
+			let minusOne = fn() { let num = 1; globalSeed - num; }
+			let minusTwo = fn() { let num = 2; globalSeed - num; }
+			minusOne() + minusTwo();`,
+			97,
+		},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+		{"return 10; 9;", 10},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `fn() { 1; }(1);`,
+			expected: `wrong number of arguments: want=0, got=1`,
+		},
+		{
+			input:    `fn(a, b) { a + b; }(1);`,
+			expected: `wrong number of arguments: want=2, got=1`,
+		},
+	}
+
+	runVmErrorTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`push([], 1)`, []int{1}},
+		{`puts("hello", "world!")`, Null},
+		{`int(2.7)`, 2},
+		{`float(2)`, 2.0},
+	}
+
+	runVmTests(t, tests)
+}
+
+// quote 的参数不求值，变量不需要定义
+func TestQuote(t *testing.T) {
+	enginetest.Run(t, enginetest.Quote, testRun)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let newClosure = fn(a) { fn() { a; }; };
+			let closure = newClosure(99);
+			closure();`,
+			99,
+		},
+		{
+			`let newAdder = fn(a, b) { fn(c) { a + b + c }; };
+			let adder = newAdder(1, 2);
+			adder(8);`,
+			11,
+		},
+		{
+			`let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);`,
+			14,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignCapturedVariables(t *testing.T) {
+	enginetest.Run(t, enginetest.AssignCapturedVariables, testRun)
+}
+
+func TestGlobalForwardReferences(t *testing.T) {
+	enginetest.Run(t, enginetest.GlobalForwardReferences, testRun)
+}
+
+// REPL 中每一行单独编译，共用符号表、常量池和全局变量
+// 出错的 let 已经在符号表中定义了名字，但没有赋值，之后使用时和求值器一样报错
+func TestGlobalsAcrossRuns(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; let y = undefinedthing", "Error: 1:20: identifier not found: undefinedthing"},
+		{"y", "Error: 1:1: identifier not found: y"},
+		{"y = 2", "Error: 1:1: identifier not found: y"},
+		{"y += 2", "Error: 1:1: identifier not found: y"},
+		{"let f = fn() { y }; x", "1"},
+		{"f()", "Error: 1:16: identifier not found: y"},
+		{"let y = 3; f() + x", "4"},
+	}
+	for _, tt := range tests {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error for %q: %s", tt.input, err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsStore(bytecode, globals)
+		var result object.Object
+		if err := machine.Run(); err != nil {
+			result = err.(*object.Error)
+		} else {
+			result = machine.LastPoppedStackElem()
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: got=%s, want=%s", tt.input, result.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			`let countDown = fn(x) {
+				if (x == 0) { return 0; } else { countDown(x - 1); }
+			};
+			countDown(1);`,
+			0,
+		},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) { return 0; } else { countDown(x - 1); }
+				};
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let fibonacci = fn(x) {
+				if (x < 2) { return x; }
+				fibonacci(x - 1) + fibonacci(x - 2);
+			};
+			fibonacci(15);`,
+			610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// 错误信息和求值器保持一致
+func TestErrorHandling(t *testing.T) {
+	enginetest.Run(t, enginetest.Errors, testRun)
+
+	// 函数的类型名和调用深度的限制和求值器不同
+	runVmErrorTests(t, []vmTestCase{
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: CLOSURE"},
+		{"let f = fn() { f() }; f();", "stack overflow"},
+	})
+}
+
+// 错误带有出错的位置和调用栈，和求值器一样打印 traceback
+func TestErrorStack(t *testing.T) {
+	input := `let check = fn(x) {
+  if (x > 2) { x + true } else { x }
+};
+let run = fn(items) {
+  let total = 0;
+  for (i in items) { total += check(i); }
+  total
+};
+let wrapper = fn() { let r = fn() { run([1, 2, 3]) }(); r };
+wrapper();`
+
+	// 虚拟机没有尾调用优化，匿名函数的栈帧还在；求值器也保留发起尾调用的栈帧，两者一致
+	expected := "Error: 2:18: type mismatch: INTEGER + BOOLEAN\n" +
+		"\tat check (6:36)\n" +
+		"\tat run (9:40)\n" +
+		"\tat <anonymous> (9:53)\n" +
+		"\tat wrapper (10:8)"
+	testVmTraceback(t, input, expected)
+
+	// 顶层产生的错误没有调用栈
+	testVmTraceback(t, "let f = fn() { 1 }; f() + true;", "Error: 1:25: type mismatch: INTEGER + BOOLEAN")
+
+	// 参数个数不对的错误发生在调用者中
+	testVmTraceback(t, "let f = fn(a, b) { a };\nlet g = fn() { f(1) + 1 };\ng();",
+		"Error: 2:17: wrong number of arguments: want=2, got=1\n\tat g (3:2)")
+
+	// 内置函数回调的函数，调用处是内置函数被调用的位置
+	testVmTraceback(t, "let f = fn(a) { map(a, fn(x) { x / 0 }) };\nf([1]);",
+		"Error: 1:34: division by zero\n\tat <anonymous> (1:20)\n\tat f (2:2)")
+
+	// 复合赋值和下标赋值的错误位置和求值器一致
+	testVmTraceback(t, "let a = [1]; a[0] += true;", "Error: 1:19: type mismatch: INTEGER + BOOLEAN")
+	testVmTraceback(t, "let a = [1]; a[5] = 1;", "Error: 1:15: index out of range: 5")
+	testVmTraceback(t, "for (x in 1) { x }", "Error: 1:11: cannot iterate over INTEGER")
+}
+
+func testVmTraceback(t *testing.T, input string, expected string) {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("%q: no error object returned. got=%T(%+v)", input, err, err)
+	}
+	if errObj.Traceback() != expected {
+		t.Errorf("%q: wrong traceback.\nwant=%q\ngot =%q", input, expected, errObj.Traceback())
+	}
+}
+
+func BenchmarkFibonacci(b *testing.B) {
+	input := `
+	let fibonacci = fn(x) {
+		if (x < 2) { return x; }
+		fibonacci(x - 1) + fibonacci(x - 2);
+	};
+	fibonacci(20);`
+
+	runVmBenchmark(b, input)
+}
+
+// 用 push 一个一个地构造有 10000 个元素的数组
+func BenchmarkArrayPush(b *testing.B) {
+	input := `
+	let arr = [];
+	let i = 0;
+	while (i < 10000) {
+		arr = push(arr, i);
+		i += 1;
+	}`
+
+	runVmBenchmark(b, input)
+}
+
+// 用 rest 一个一个地遍历有 10000 个元素的数组
+func BenchmarkArrayRest(b *testing.B) {
+	input := `
+	let arr = range(10000);
+	let sum = 0;
+	while (len(arr) > 0) {
+		sum += first(arr);
+		arr = rest(arr);
+	}`
+
+	runVmBenchmark(b, input)
+}
+
+// 用 set 一个一个地替换有 10000 个元素的数组中的元素
+func BenchmarkArraySet(b *testing.B) {
+	input := `
+	let arr = range(10000);
+	let i = 0;
+	while (i < 10000) {
+		arr = set(arr, i, i * 2);
+		i += 1;
+	}`
+
+	runVmBenchmark(b, input)
+}
+
+func runVmBenchmark(b *testing.B, input string) {
+	b.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		machine := New(bytecode)
+		if err := machine.Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.input, tt.expected, stackElem)
+	}
+}
+
+// 编译并执行，运行时的错误作为错误对象返回，和求值器的 testEval 一样供共用的测试用例使用
+func testRun(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error for %q: %s", input, err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return err.(*object.Error)
+	}
+	return vm.LastPoppedStackElem()
+}
+
+func runVmErrorTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Errorf("expected VM error for %q but resulted in none.", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong VM error for %q. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("testIntegerObject failed for %q: %s", input, err)
+		}
+
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok || result.Value != expected {
+			t.Errorf("object is not Float(%g) for %q. got=%T (%+v)", expected, input, actual, actual)
+		}
+
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok || result.Value != expected {
+			t.Errorf("object is not Boolean(%t) for %q. got=%T (%+v)", expected, input, actual, actual)
+		}
+
+	case string:
+		result, ok := actual.(*object.String)
+		if !ok || result.Value != expected {
+			t.Errorf("object is not String(%q) for %q. got=%T (%+v)", expected, input, actual, actual)
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("object is not Null for %q: %T (%+v)", input, actual, actual)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array for %q: %T (%+v)", input, actual, actual)
+			return
+		}
+
+		if array.Len() != len(expected) {
+			t.Errorf("wrong num of elements for %q. want=%d, got=%d",
+				input, len(expected), array.Len())
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.At(i))
+			if err != nil {
+				t.Errorf("testIntegerObject failed for %q: %s", input, err)
+			}
+		}
+
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash for %q. got=%T (%+v)", input, actual, actual)
+			return
+		}
+
+		if hash.Len() != len(expected) {
+			t.Errorf("hash has wrong number of Pairs for %q. want=%d, got=%d",
+				input, len(expected), hash.Len())
+			return
+		}
+
+		for _, pair := range hash.Pairs() {
+			expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
+			if !ok {
+				t.Errorf("unexpected key %s in Pairs for %q", pair.Key.Inspect(), input)
+			}
+
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("testIntegerObject failed for %q: %s", input, err)
+			}
+		}
+	}
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+
+	return nil
+}